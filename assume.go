@@ -0,0 +1,102 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+// Minimum share of a node taken by an in-flight pod, so pods without requests count too
+const minInFlightShare = 0.05
+
+// Pods placed by the scheduler whose placement may not be reflected yet by the cluster state
+// or by the metrics. They are accounted in their nodes until the assumption expires.
+type assumeCache struct {
+	Timeout time.Duration
+	pods    map[string]assumedPod // By pod namespace and name
+	mutex   sync.Mutex
+}
+
+type assumedPod struct {
+	pod      kube.KubePod
+	deadline time.Time
+}
+
+func podKey(pod kube.KubePod) string {
+	return pod.Metadata.Namespace + "/" + pod.Metadata.Name
+}
+
+// Records the pod as placed in the node
+func (c *assumeCache) assume(pod kube.KubePod, node string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.pods == nil {
+		c.pods = map[string]assumedPod{}
+	}
+	pod.Spec.NodeName = node
+	c.pods[podKey(pod)] = assumedPod{pod: pod, deadline: time.Now().Add(c.Timeout)}
+}
+
+// Checks if the pod has been placed and the assumption hasn't expired yet
+func (c *assumeCache) isAssumed(pod kube.KubePod) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	assumed, ok := c.pods[podKey(pod)]
+	return ok && time.Now().Before(assumed.deadline)
+}
+
+// Drops the assumption, the pod binding failed or the pod is gone
+func (c *assumeCache) forget(pod kube.KubePod) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.pods, podKey(pod))
+}
+
+// Returns the pods assumed and not expired yet
+func (c *assumeCache) list() (pods []kube.KubePod) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for key, assumed := range c.pods {
+		if now.After(assumed.deadline) {
+			delete(c.pods, key)
+			continue
+		}
+		pods = append(pods, assumed.pod)
+	}
+	return
+}
+
+// Share of the node that the in-flight pods will take once they are running, estimated from their requests.
+// The metrics of the node don't reflect it yet, so it is subtracted from the metrics score of the node.
+func (n *nodeInfo) inFlightLoad() (load float64) {
+	for _, pod := range n.assumedPods {
+		requests := podRequests(pod)
+		share := minInFlightShare
+		for _, resource := range []string{"cpu", "memory"} {
+			if n.allocatable[resource] > 0 {
+				share = math.Max(share, requests[resource]/n.allocatable[resource])
+			}
+		}
+		load += share
+	}
+	return
+}
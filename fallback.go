@@ -0,0 +1,116 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+// Annotation of a pod overriding the default fallback strategy
+const fallbackAnnotation = "scheduling.sysdig.com/fallback"
+
+// Errors
+var (
+	errFallbackRetry   = errors.New("fallback: retry later")
+	errFallbackPending = errors.New("fallback: left pending")
+)
+
+// What to do with a pod when the metrics can't choose a node for it
+type fallbackStrategy struct {
+	kind    string   // retry, random, round-robin, metric or pending
+	metrics []Metric // Secondary metrics of the metric strategy
+}
+
+var (
+	defaultFallback = fallbackStrategy{kind: "retry"}
+	roundRobinNext  = map[string]int{} // Next node of the round-robin strategy by workload, only used while scheduling
+)
+
+// Parses a fallback strategy: "retry", "random", "round-robin", "pending" or "metric:METRICS",
+// where METRICS has the same format as the scoring metrics
+func parseFallback(spec string) (strategy fallbackStrategy, err error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "retry", "random", "round-robin", "pending":
+		return fallbackStrategy{kind: spec}, nil
+	}
+
+	if strings.HasPrefix(spec, "metric:") {
+		metrics, err := parseMetrics(strings.TrimPrefix(spec, "metric:"))
+		if err != nil {
+			return strategy, err
+		}
+		return fallbackStrategy{kind: "metric", metrics: metrics}, nil
+	}
+	return strategy, fmt.Errorf("unknown fallback strategy %q", spec)
+}
+
+// Returns the fallback strategy of the pod, the default one unless the pod annotation sets a valid one
+func podFallback(pod kube.KubePod) fallbackStrategy {
+	spec, ok := pod.Metadata.Annotations[fallbackAnnotation]
+	if !ok {
+		return defaultFallback
+	}
+	strategy, err := parseFallback(spec)
+	if err != nil {
+		log.Printf("pod %s: %s, using the default fallback\n", pod.Metadata.Name, err)
+		return defaultFallback
+	}
+	return strategy
+}
+
+// Chooses a node for the queued pod among the available ones when the scoring metrics failed, the
+// round-robin strategy spreads the pods of each workload over the nodes.
+// Returns errFallbackRetry or errFallbackPending when the strategy doesn't choose a node.
+func fallbackNode(queued *queuedPod, nodes []*nodeInfo, cluster *snapshot) (node Node, err error) {
+	pod := queued.pod
+	strategy := podFallback(pod)
+	log.Printf("falling back to the %s strategy for %s\n", strategy.kind, pod.Metadata.Name)
+
+	if len(nodes) == 0 {
+		return node, emptyNodeList
+	}
+
+	switch strategy.kind {
+	case "random":
+		return Node{name: nodes[rand.Intn(len(nodes))].node.Metadata.Name}, nil
+	case "round-robin":
+		workload := queued.podWorkload().String()
+		node = Node{name: nodes[roundRobinNext[workload]%len(nodes)].node.Metadata.Name}
+		roundRobinNext[workload]++
+		return node, nil
+	case "metric":
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			names = append(names, node.node.Metadata.Name)
+		}
+		nodeList, err := fetchNodesMetrics(names, strategy.metrics)
+		if err != nil {
+			return node, err
+		}
+		return rankNodes(pod, nodeList, strategy.metrics, cluster)
+	case "pending":
+		return node, errFallbackPending
+	}
+	return node, errFallbackRetry
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+const (
+	podGroupLabel         = "scheduling.sysdig.com/group"      // Pod group name
+	podGroupMinMemberKey  = "scheduling.sysdig.com/min-member" // Annotation (or label) with the pods to place together
+	podGroupWaitTimeout   = 60 * time.Second                   // Shorter than the assumption of the waiting pods
+	podGroupTimeoutPeriod = 1 * time.Second
+)
+
+// A pod placed in a node, waiting to be bound
+type permittedPod struct {
+	queued *queuedPod
+	node   string
+}
+
+// Pods of a group waiting for the rest of the group to be placed
+type waitingGroup struct {
+	pods  map[string]permittedPod // By pod key
+	since time.Time
+}
+
+// Holds the members of a pod group until at least min-member of them can be placed at the same time.
+// The waiting members are assumed in their nodes, so the next members are placed taking them into account.
+type gangPermits struct {
+	groups map[string]*waitingGroup // By namespace and group name
+	mutex  sync.Mutex
+}
+
+func newGangPermits() *gangPermits {
+	return &gangPermits{groups: map[string]*waitingGroup{}}
+}
+
+// Returns the group of the pod and its minimum number of members, ok is false when the pod isn't in a group
+func podGroup(pod kube.KubePod) (group string, minMember int, ok bool) {
+	name, ok := pod.Metadata.Labels[podGroupLabel]
+	if !ok || name == "" {
+		return "", 0, false
+	}
+	value, ok := pod.Metadata.Annotations[podGroupMinMemberKey]
+	if !ok {
+		value = pod.Metadata.Labels[podGroupMinMemberKey]
+	}
+	minMember, err := strconv.Atoi(value)
+	if err != nil || minMember < 1 {
+		minMember = 1
+	}
+	return pod.Metadata.Namespace + "/" + name, minMember, true
+}
+
+// Decides if the pod placed in the node can be bound. Returns the pods to bind now: the pod alone when it
+// isn't in a group, the waiting members and the pod once the group reaches min-member, or nothing.
+func (g *gangPermits) permit(queued *queuedPod, node string, cluster *snapshot) []permittedPod {
+	current := permittedPod{queued: queued, node: node}
+	group, minMember, ok := podGroup(queued.pod)
+	if !ok {
+		return []permittedPod{current}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	waiting, ok := g.groups[group]
+	if !ok {
+		waiting = &waitingGroup{pods: map[string]permittedPod{}, since: time.Now()}
+		g.groups[group] = waiting
+	}
+	waiting.pods[podKey(queued.pod)] = current
+
+	// The members already bound, or placed and waiting, are in the cluster snapshot
+	members := map[string]bool{podKey(queued.pod): true}
+	for _, node := range cluster.nodes {
+		for _, pod := range node.pods {
+			if memberGroup, _, ok := podGroup(pod); ok && memberGroup == group {
+				members[podKey(pod)] = true
+			}
+		}
+	}
+	if len(members) < minMember {
+		log.Printf("pod group %s: %d/%d members placed, %s waiting\n", group, len(members), minMember, queued.pod.Metadata.Name)
+		return nil
+	}
+
+	delete(g.groups, group)
+	permitted := make([]permittedPod, 0, len(waiting.pods))
+	for _, pod := range waiting.pods {
+		permitted = append(permitted, pod)
+	}
+	return permitted
+}
+
+// Drops a deleted pod from its waiting group
+func (g *gangPermits) forget(pod kube.KubePod) {
+	group, _, ok := podGroup(pod)
+	if !ok {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if waiting, ok := g.groups[group]; ok {
+		delete(waiting.pods, podKey(pod))
+	}
+}
+
+// Rejects the groups waiting for too long: their members release their nodes and are retried later
+func (g *gangPermits) Run() {
+	ticker := time.NewTicker(podGroupTimeoutPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		g.mutex.Lock()
+		for group, waiting := range g.groups {
+			if time.Since(waiting.since) < podGroupWaitTimeout {
+				continue
+			}
+			log.Printf("pod group %s: timeout waiting for its members, %d pods released\n", group, len(waiting.pods))
+			delete(g.groups, group)
+			for _, pod := range waiting.pods {
+				assumedPods.forget(pod.queued.pod)
+				queue.AddBackoff(pod.queued)
+			}
+		}
+		g.mutex.Unlock()
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import "strconv"
+
+type KubeAffinity struct {
+	NodeAffinity    KubeNodeAffinity `json:"nodeAffinity"`
+	PodAffinity     KubePodAffinity  `json:"podAffinity"`
+	PodAntiAffinity KubePodAffinity  `json:"podAntiAffinity"`
+}
+
+type KubeNodeAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution  *KubeNodeSelector             `json:"requiredDuringSchedulingIgnoredDuringExecution"`
+	PreferredDuringSchedulingIgnoredDuringExecution []KubePreferredSchedulingTerm `json:"preferredDuringSchedulingIgnoredDuringExecution"`
+}
+
+// A node matching the preference adds the weight (1-100) to the node affinity score
+type KubePreferredSchedulingTerm struct {
+	Weight     int                  `json:"weight"`
+	Preference KubeNodeSelectorTerm `json:"preference"`
+}
+
+// Used both for pod affinity and anti-affinity
+type KubePodAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution  []KubePodAffinityTerm         `json:"requiredDuringSchedulingIgnoredDuringExecution"`
+	PreferredDuringSchedulingIgnoredDuringExecution []KubeWeightedPodAffinityTerm `json:"preferredDuringSchedulingIgnoredDuringExecution"`
+}
+
+// Selects the pods in the namespaces (the pod namespace by default) with the labels, within the
+// topology domain of the node: the nodes with the same value of the topologyKey label.
+type KubePodAffinityTerm struct {
+	LabelSelector *KubeLabelSelector `json:"labelSelector"`
+	Namespaces    []string           `json:"namespaces"`
+	TopologyKey   string             `json:"topologyKey"`
+}
+
+type KubeWeightedPodAffinityTerm struct {
+	Weight          int                 `json:"weight"`
+	PodAffinityTerm KubePodAffinityTerm `json:"podAffinityTerm"`
+}
+
+// Checks if the term of a pod (the owner) selects another pod
+func (t KubePodAffinityTerm) MatchesPod(owner, pod KubePod) bool {
+	namespaces := t.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{owner.Metadata.Namespace}
+	}
+	return contains(namespaces, pod.Metadata.Namespace) && t.LabelSelector.Matches(pod.Metadata.Labels)
+}
+
+// The node selector terms are ORed
+type KubeNodeSelector struct {
+	NodeSelectorTerms []KubeNodeSelectorTerm `json:"nodeSelectorTerms"`
+}
+
+// The requirements of a term are ANDed
+type KubeNodeSelectorTerm struct {
+	MatchExpressions []KubeNodeSelectorRequirement `json:"matchExpressions"`
+	MatchFields      []KubeNodeSelectorRequirement `json:"matchFields"`
+}
+
+type KubeNodeSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"` // In, NotIn, Exists, DoesNotExist, Gt or Lt
+	Values   []string `json:"values"`
+}
+
+// Checks if the node matches any of the terms, a selector without terms matches no node
+func (s KubeNodeSelector) Matches(node KubeNode) bool {
+	for _, term := range s.NodeSelectorTerms {
+		if term.Matches(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the node labels and fields match all the requirements, an empty term matches no node
+func (t KubeNodeSelectorTerm) Matches(node KubeNode) bool {
+	if len(t.MatchExpressions) == 0 && len(t.MatchFields) == 0 {
+		return false
+	}
+	for _, requirement := range t.MatchExpressions {
+		if !requirement.Matches(node.Metadata.Labels) {
+			return false
+		}
+	}
+	// metadata.name is the only field supported by Kubernetes
+	fields := map[string]string{"metadata.name": node.Metadata.Name}
+	for _, requirement := range t.MatchFields {
+		if !requirement.Matches(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the labels match the requirement
+func (r KubeNodeSelectorRequirement) Matches(labels map[string]string) bool {
+	value, exists := labels[r.Key]
+	switch r.Operator {
+	case "In":
+		return exists && contains(r.Values, value)
+	case "NotIn":
+		return !exists || !contains(r.Values, value)
+	case "Exists":
+		return exists
+	case "DoesNotExist":
+		return !exists
+	case "Gt", "Lt":
+		if !exists || len(r.Values) != 1 {
+			return false
+		}
+		labelValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		requiredValue, err := strconv.ParseInt(r.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		if r.Operator == "Gt" {
+			return labelValue > requiredValue
+		}
+		return labelValue < requiredValue
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tokenFileRefresh = 1 * time.Minute  // How often a token file is read again
+	expiryDelta      = 10 * time.Second // Tokens are renewed a bit before they expire
+	commandTimeout   = 1 * time.Minute  // Time limit of the credential commands
+)
+
+// Returns the token source of the user, nil when the user doesn't authenticate with a token
+func newTokenSource(user UserData, cluster ClusterData) (source tokenSource, err error) {
+	switch {
+	case user.Token != "":
+		return staticTokenSource(user.Token), nil
+	case user.TokenFile != "":
+		return newFileTokenSource(user.TokenFile, tokenFileRefresh), nil
+	case user.Exec != nil:
+		if user.Exec.Command == "" {
+			return nil, errors.New("kubernetes: the exec credential plugin has no command")
+		}
+		return &execTokenSource{config: *user.Exec, cluster: cluster}, nil
+	case user.AuthProvider != nil:
+		return newAuthProviderTokenSource(*user.AuthProvider)
+	}
+	return nil, nil
+}
+
+// Resolves a path relative to a directory, absolute paths are kept
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Provides the bearer token of the requests to the API server.
+// The implementations are pointers, so the copies of the api share them.
+type tokenSource interface {
+	Token() (token string, err error)
+}
+
+// Token read from a file. The file is read again periodically, the kubelet rotates
+// the bound service account tokens before they expire.
+type fileTokenSource struct {
+	path   string
+	period time.Duration
+
+	mutex  sync.Mutex
+	token  string
+	readAt time.Time
+}
+
+func newFileTokenSource(path string, period time.Duration) *fileTokenSource {
+	return &fileTokenSource{path: path, period: period}
+}
+
+func (s *fileTokenSource) Token() (token string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != "" && time.Since(s.readAt) < s.period {
+		return s.token, nil
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if s.token != "" { // Keep using the last token, it may still be valid
+			log.Printf("kubernetes: error while reading the token %s: %s\n", s.path, err)
+			return s.token, nil
+		}
+		return "", fmt.Errorf("kubernetes: error while reading the token: %s", err)
+	}
+	s.token = strings.TrimSpace(string(data))
+	s.readAt = time.Now()
+	return s.token, nil
+}
+
+// Token set in the kubeconfig
+type staticTokenSource string
+
+func (s staticTokenSource) Token() (string, error) {
+	return string(s), nil
+}
+
+// Token returned by a client.authentication.k8s.io credential plugin, run again when the token expires
+type execTokenSource struct {
+	config  ExecConfig
+	cluster ClusterData
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time // Zero when the token doesn't expire
+}
+
+func (s *execTokenSource) Token() (token string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Add(expiryDelta).Before(s.expiry)) {
+		return s.token, nil
+	}
+
+	apiVersion := s.config.APIVersion
+	if apiVersion == "" {
+		apiVersion = "client.authentication.k8s.io/v1beta1"
+	}
+	spec := map[string]interface{}{"interactive": false}
+	if s.config.ProvideClusterInfo {
+		spec["cluster"] = map[string]interface{}{
+			"server":                     s.cluster.Server,
+			"certificate-authority-data": base64.StdEncoding.EncodeToString(s.cluster.CertificateAuthorityData),
+		}
+	}
+	execInfo, err := json.Marshal(map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       "ExecCredential",
+		"spec":       spec,
+	})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.config.Command, s.config.Args...)
+	cmd.Env = append(os.Environ(), "KUBERNETES_EXEC_INFO="+string(execInfo))
+	for _, env := range s.config.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("kubernetes: exec credential plugin %s: %s", s.config.Command, err)
+	}
+
+	var credential struct {
+		Status struct {
+			Token               string     `json:"token"`
+			ExpirationTimestamp *time.Time `json:"expirationTimestamp"`
+		} `json:"status"`
+	}
+	if err = json.Unmarshal(output, &credential); err != nil {
+		return "", fmt.Errorf("kubernetes: exec credential plugin %s: %s", s.config.Command, err)
+	}
+	if credential.Status.Token == "" {
+		return "", fmt.Errorf("kubernetes: exec credential plugin %s returned no token, client certificates aren't supported", s.config.Command)
+	}
+
+	s.token = credential.Status.Token
+	s.expiry = time.Time{}
+	if credential.Status.ExpirationTimestamp != nil {
+		s.expiry = *credential.Status.ExpirationTimestamp
+	}
+	return s.token, nil
+}
+
+// Token of an auth-provider (gcp, oidc...): the one in its config while it doesn't expire,
+// then the one printed by its cmd-path, found in the output by token-key and expiry-key
+type authProviderTokenSource struct {
+	config AuthProviderConfig
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time // Zero when the token doesn't expire
+}
+
+func newAuthProviderTokenSource(provider AuthProvider) (source tokenSource, err error) {
+	config := provider.Config
+	token := config.AccessToken
+	if provider.Name == "oidc" {
+		token = config.IDToken
+	}
+	if config.CmdPath == "" {
+		if token == "" {
+			return nil, fmt.Errorf("kubernetes: the auth-provider %s has no token nor cmd-path", provider.Name)
+		}
+		return staticTokenSource(token), nil
+	}
+
+	if config.TokenKey == "" {
+		config.TokenKey = "{.access_token}"
+	}
+	if config.ExpiryKey == "" {
+		config.ExpiryKey = "{.token_expiry}"
+	}
+	expiry, _ := time.Parse(time.RFC3339, config.Expiry)
+	if token != "" && expiry.IsZero() { // Without expiry the token can't be trusted, run the command
+		token = ""
+	}
+	return &authProviderTokenSource{config: config, token: token, expiry: expiry}, nil
+}
+
+func (s *authProviderTokenSource) Token() (token string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Add(expiryDelta).Before(s.expiry)) {
+		return s.token, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.config.CmdPath, strings.Fields(s.config.CmdArgs)...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("kubernetes: auth-provider command %s: %s", s.config.CmdPath, err)
+	}
+
+	var data interface{}
+	if err = json.Unmarshal(output, &data); err != nil {
+		return "", fmt.Errorf("kubernetes: auth-provider command %s: %s", s.config.CmdPath, err)
+	}
+	token, ok := jsonPathValue(data, s.config.TokenKey)
+	if !ok || token == "" {
+		return "", fmt.Errorf("kubernetes: auth-provider command %s: no token at %s", s.config.CmdPath, s.config.TokenKey)
+	}
+	s.token = token
+	s.expiry = time.Time{}
+	if value, ok := jsonPathValue(data, s.config.ExpiryKey); ok {
+		if expiry, err := time.Parse(time.RFC3339, value); err == nil {
+			s.expiry = expiry
+		}
+	}
+	return s.token, nil
+}
+
+// Returns the string at a simple JSONPath of decoded JSON, like {.credential.access_token}
+func jsonPathValue(data interface{}, path string) (value string, ok bool) {
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}")
+	for _, key := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		object, isObject := data.(map[string]interface{})
+		if !isObject {
+			return "", false
+		}
+		if data, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+	value, ok = data.(string)
+	return
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	inClusterName     = "in-cluster" // Name of the cluster, user and context of the in-cluster config
+)
+
+var ErrNotInCluster = errors.New("kubernetes: not running in a cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+
+// Checks if the scheduler runs as a pod
+func InCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" && os.Getenv("KUBERNETES_SERVICE_PORT") != ""
+}
+
+// Loads the config from the environment and the service account of the pod running the scheduler
+func (api *KubernetesCoreV1Api) LoadInClusterConfig() (err error) {
+	if !InCluster() {
+		return ErrNotInCluster
+	}
+	server := "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+
+	caCert, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return
+	}
+	token := newFileTokenSource(serviceAccountDir+"/token", tokenFileRefresh)
+	if _, err = token.Token(); err != nil {
+		return
+	}
+
+	// The namespace of the pod is the default one
+	namespace := "default"
+	if data, err := ioutil.ReadFile(serviceAccountDir + "/namespace"); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	api.config = KubeConf{
+		Clusters: []Cluster{{
+			Name: inClusterName,
+			Data: ClusterData{Server: server, CertificateAuthorityData: caCert},
+		}},
+		Contexts: []Context{{
+			Name: inClusterName,
+			Data: ContextData{Cluster: inClusterName, User: inClusterName, Namespace: namespace},
+		}},
+		CurrentContext: inClusterName,
+		Users:          []User{{Name: inClusterName}},
+	}
+	api.tokenSource = token
+	api.namespace = namespace
+	api.loadTLSInfo()
+	api.nodeInformer = api.NewNodeInformer()
+	return
+}
@@ -0,0 +1,388 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Indexes of the stores
+const (
+	IndexNamespace = "namespace" // Namespace of the object
+	IndexNodeName  = "nodeName"  // Node where the pod is bound, empty while pending
+	IndexLabels    = "labels"    // One "key=value" entry per label
+)
+
+// Returns the values indexing an object in an index
+type IndexFunc func(object interface{}) []string
+
+// Key of an object in a store, only the name for the objects without namespace
+func objectKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+func labelsIndexValues(labels map[string]string) (values []string) {
+	for key, value := range labels {
+		values = append(values, key+"="+value)
+	}
+	return
+}
+
+// Thread safe store of objects by key, with indexes to find them by other fields
+type Store struct {
+	mutex    sync.RWMutex
+	objects  map[string]interface{}
+	indexers map[string]IndexFunc
+	indexes  map[string]map[string]map[string]bool // Keys of the objects by index and value
+}
+
+func NewStore(indexers map[string]IndexFunc) *Store {
+	store := &Store{
+		objects:  map[string]interface{}{},
+		indexers: indexers,
+		indexes:  map[string]map[string]map[string]bool{},
+	}
+	for name := range indexers {
+		store.indexes[name] = map[string]map[string]bool{}
+	}
+	return store
+}
+
+// Adds or replaces the object of the key, returns the replaced one
+func (s *Store) put(key string, object interface{}) (old interface{}, exists bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists = s.objects[key]
+	if exists {
+		s.unindex(key, old)
+	}
+	s.objects[key] = object
+	for name, indexer := range s.indexers {
+		for _, value := range indexer(object) {
+			if s.indexes[name][value] == nil {
+				s.indexes[name][value] = map[string]bool{}
+			}
+			s.indexes[name][value][key] = true
+		}
+	}
+	return
+}
+
+// Removes the object of the key, returns it
+func (s *Store) delete(key string) (old interface{}, exists bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists = s.objects[key]
+	if exists {
+		s.unindex(key, old)
+		delete(s.objects, key)
+	}
+	return
+}
+
+func (s *Store) unindex(key string, object interface{}) {
+	for name, indexer := range s.indexers {
+		for _, value := range indexer(object) {
+			delete(s.indexes[name][value], key)
+			if len(s.indexes[name][value]) == 0 {
+				delete(s.indexes[name], value)
+			}
+		}
+	}
+}
+
+func (s *Store) Get(key string) (object interface{}, ok bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	object, ok = s.objects[key]
+	return
+}
+
+// Returns all the objects, sorted by key
+func (s *Store) List() (objects []interface{}) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.sortedObjects(s.keys())
+}
+
+// Returns the keys of all the objects
+func (s *Store) Keys() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.keys()
+}
+
+func (s *Store) keys() []string {
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Returns the objects with the value in the index, sorted by key
+func (s *Store) ByIndex(index, value string) (objects []interface{}) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys := make([]string, 0, len(s.indexes[index][value]))
+	for key := range s.indexes[index][value] {
+		keys = append(keys, key)
+	}
+	return s.sortedObjects(keys)
+}
+
+func (s *Store) sortedObjects(keys []string) (objects []interface{}) {
+	sort.Strings(keys)
+	for _, key := range keys {
+		objects = append(objects, s.objects[key])
+	}
+	return
+}
+
+// Functions called on the changes of the objects of an informer, after the store has been updated.
+// They are called one at a time, from the goroutine running the informer. Any of them can be nil.
+type EventHandler struct {
+	OnAdd    func(object interface{})
+	OnUpdate func(old, new interface{})
+	OnDelete func(object interface{})
+}
+
+// Keeps a store up to date with the objects of an endpoint with a ListWatch, and calls the handlers on their changes.
+// The store is also what the ListWatch knows of the objects when it lists them again.
+type Informer struct {
+	api       KubernetesCoreV1Api
+	apiMethod string
+	values    url.Values
+	decode    func(data []byte) (object interface{}, key string, err error)
+	version   func(object interface{}) string // Resource version of an object
+	store     *Store
+
+	mutex    sync.Mutex
+	handlers []EventHandler
+	synced   chan struct{} // Closed once the first list is in the store
+	syncOnce sync.Once
+}
+
+func newInformer(api KubernetesCoreV1Api, apiMethod string, indexers map[string]IndexFunc, decode func(data []byte) (interface{}, string, error), version func(object interface{}) string) *Informer {
+	return &Informer{
+		api:       api,
+		apiMethod: apiMethod,
+		decode:    decode,
+		version:   version,
+		store:     NewStore(indexers),
+		synced:    make(chan struct{}),
+	}
+}
+
+// Adds handlers, they must be added before Run
+func (i *Informer) AddEventHandler(handler EventHandler) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.handlers = append(i.handlers, handler)
+}
+
+func (i *Informer) Store() *Store {
+	return i.store
+}
+
+// Checks if the store holds the objects listed at least once
+func (i *Informer) HasSynced() bool {
+	select {
+	case <-i.synced:
+		return true
+	default:
+		return false
+	}
+}
+
+// Waits until the store holds the objects listed at least once, returns false if the context is done first
+func (i *Informer) WaitForSync(ctx context.Context) bool {
+	select {
+	case <-i.synced:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Lists and watches the objects until the context is done
+func (i *Informer) Run(ctx context.Context) {
+	i.mutex.Lock()
+	handlers := append([]EventHandler{}, i.handlers...)
+	i.mutex.Unlock()
+
+	i.api.listWatch(ctx, i.apiMethod, i.values, i, func(event KubeWatchEvent) bool {
+		object, key, err := i.decode(event.Object)
+		if err != nil {
+			log.Printf("kubernetes: error while decoding an object of %s: %s\n", i.apiMethod, err)
+			return true
+		}
+
+		if event.Type == "DELETED" {
+			if old, exists := i.store.delete(key); exists {
+				for _, handler := range handlers {
+					if handler.OnDelete != nil {
+						handler.OnDelete(old)
+					}
+				}
+			}
+			return true
+		}
+
+		old, exists := i.store.put(key, object)
+		for _, handler := range handlers {
+			switch {
+			case exists && handler.OnUpdate != nil:
+				handler.OnUpdate(old, object)
+			case !exists && handler.OnAdd != nil:
+				handler.OnAdd(object)
+			}
+		}
+		return true
+	}, func() {
+		i.syncOnce.Do(func() { close(i.synced) })
+	})
+}
+
+func (i *Informer) keys() []string {
+	return i.store.Keys()
+}
+
+func (i *Informer) resourceVersion(key string) (resourceVersion string, ok bool) {
+	object, ok := i.store.Get(key)
+	if ok {
+		resourceVersion = i.version(object)
+	}
+	return
+}
+
+// Only the name and namespace of the object, its handler finds it in the store
+func (i *Informer) deleted(key string) json.RawMessage {
+	var object watchObject
+	object.Metadata.Name = key
+	if slash := strings.Index(key, "/"); slash >= 0 {
+		object.Metadata.Namespace, object.Metadata.Name = key[:slash], key[slash+1:]
+	}
+	data, _ := json.Marshal(object)
+	return data
+}
+
+// Informer of the pods of all the namespaces, indexed by namespace, node name and labels
+type PodInformer struct {
+	*Informer
+}
+
+func (api KubernetesCoreV1Api) NewPodInformer() PodInformer {
+	indexers := map[string]IndexFunc{
+		IndexNamespace: func(object interface{}) []string {
+			return []string{object.(KubePod).Metadata.Namespace}
+		},
+		IndexNodeName: func(object interface{}) []string {
+			return []string{object.(KubePod).Spec.NodeName}
+		},
+		IndexLabels: func(object interface{}) []string {
+			return labelsIndexValues(object.(KubePod).Metadata.Labels)
+		},
+	}
+	return PodInformer{newInformer(api, "api/v1/pods", indexers, func(data []byte) (interface{}, string, error) {
+		var pod KubePod
+		err := json.Unmarshal(data, &pod)
+		return pod, objectKey(pod.Metadata.Namespace, pod.Metadata.Name), err
+	}, func(object interface{}) string {
+		return object.(KubePod).Metadata.ResourceVersion
+	})}
+}
+
+func (i PodInformer) Get(namespace, name string) (pod KubePod, ok bool) {
+	object, ok := i.store.Get(objectKey(namespace, name))
+	if ok {
+		pod = object.(KubePod)
+	}
+	return
+}
+
+func (i PodInformer) List() []KubePod {
+	return toPods(i.store.List())
+}
+
+// Returns the pods with the value in the index, like the pods bound to a node with IndexNodeName
+func (i PodInformer) ByIndex(index, value string) []KubePod {
+	return toPods(i.store.ByIndex(index, value))
+}
+
+func toPods(objects []interface{}) (pods []KubePod) {
+	for _, object := range objects {
+		pods = append(pods, object.(KubePod))
+	}
+	return
+}
+
+// Informer of the nodes, indexed by labels
+type NodeInformer struct {
+	*Informer
+}
+
+func (api KubernetesCoreV1Api) NewNodeInformer() NodeInformer {
+	indexers := map[string]IndexFunc{
+		IndexLabels: func(object interface{}) []string {
+			return labelsIndexValues(object.(KubeNode).Metadata.Labels)
+		},
+	}
+	return NodeInformer{newInformer(api, "api/v1/nodes", indexers, func(data []byte) (interface{}, string, error) {
+		var node KubeNode
+		err := json.Unmarshal(data, &node)
+		return node, objectKey("", node.Metadata.Name), err
+	}, func(object interface{}) string {
+		return object.(KubeNode).Metadata.ResourceVersion
+	})}
+}
+
+func (i NodeInformer) Get(name string) (node KubeNode, ok bool) {
+	object, ok := i.store.Get(objectKey("", name))
+	if ok {
+		node = object.(KubeNode)
+	}
+	return
+}
+
+func (i NodeInformer) List() []KubeNode {
+	return toNodes(i.store.List())
+}
+
+// Returns the nodes with the value in the index, like the nodes with a label with IndexLabels
+func (i NodeInformer) ByIndex(index, value string) []KubeNode {
+	return toNodes(i.store.ByIndex(index, value))
+}
+
+func toNodes(objects []interface{}) (nodes []KubeNode) {
+	for _, object := range objects {
+		nodes = append(nodes, object.(KubeNode))
+	}
+	return
+}
@@ -16,6 +16,16 @@ limitations under the License.
 
 package kubernetes
 
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
 type KubeConf struct {
 	ApiVersion     string    `yaml:"apiVersion"`
 	Clusters       []Cluster `yaml:"clusters"`
@@ -33,7 +43,10 @@ type Cluster struct {
 type ClusterData struct {
 	CertificateAuthorityDataStr string `yaml:"certificate-authority-data"`
 	CertificateAuthorityData    []byte
+	CertificateAuthority        string `yaml:"certificate-authority"` // Path of the certificate, when there is no data
 	Server                      string `yaml:"server"`
+	InsecureSkipTLSVerify       bool   `yaml:"insecure-skip-tls-verify"`
+	TLSServerName               string `yaml:"tls-server-name"` // Name checked in the server certificate instead of the server host
 }
 
 type Context struct {
@@ -42,14 +55,14 @@ type Context struct {
 }
 
 type ContextData struct {
-	Cluster string `yaml:"cluster"`
-	User    string `yaml:"user"`
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace"` // Default namespace of the context
 }
 
 type User struct {
-	Name         string       `yaml:"name"`
-	Data         UserData     `yaml:"user"`
-	AuthProvider AuthProvider `yaml:"auth-provider"`
+	Name string   `yaml:"name"`
+	Data UserData `yaml:"user"`
 }
 
 type UserData struct {
@@ -57,6 +70,28 @@ type UserData struct {
 	ClientCertificateData    []byte
 	ClientKeyDataStr         string `yaml:"client-key-data"`
 	ClientKeyData            []byte
+	ClientCertificate        string        `yaml:"client-certificate"` // Paths of the certificate and the key, when there is no data
+	ClientKey                string        `yaml:"client-key"`
+	Token                    string        `yaml:"token"`
+	TokenFile                string        `yaml:"tokenFile"`
+	Username                 string        `yaml:"username"`
+	Password                 string        `yaml:"password"`
+	Exec                     *ExecConfig   `yaml:"exec"`
+	AuthProvider             *AuthProvider `yaml:"auth-provider"`
+}
+
+// Credential plugin run to get a token (client.authentication.k8s.io ExecCredential)
+type ExecConfig struct {
+	APIVersion         string       `yaml:"apiVersion"`
+	Command            string       `yaml:"command"`
+	Args               []string     `yaml:"args"`
+	Env                []ExecEnvVar `yaml:"env"`
+	ProvideClusterInfo bool         `yaml:"provideClusterInfo"`
+}
+
+type ExecEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
 }
 
 type AuthProvider struct {
@@ -65,8 +100,143 @@ type AuthProvider struct {
 }
 
 type AuthProviderConfig struct {
-	CmdArgs   string `yaml:"cmd-args"`
-	CmdPath   string `yaml:"cmd-path"`
-	ExpiryKey string `yaml:"expiry-key"`
-	TokenKey  string `yaml:"token-key"`
+	AccessToken string `yaml:"access-token"`
+	IDToken     string `yaml:"id-token"`
+	CmdArgs     string `yaml:"cmd-args"`
+	CmdPath     string `yaml:"cmd-path"`
+	Expiry      string `yaml:"expiry"`
+	ExpiryKey   string `yaml:"expiry-key"`
+	TokenKey    string `yaml:"token-key"`
+}
+
+// Returns the current context, with its cluster and its user
+func (c KubeConf) current() (context ContextData, cluster ClusterData, user UserData, err error) {
+	contextFound := false
+	for _, item := range c.Contexts {
+		if item.Name == c.CurrentContext {
+			context, contextFound = item.Data, true
+		}
+	}
+	if !contextFound {
+		err = fmt.Errorf("kubernetes: context %q not found", c.CurrentContext)
+		return
+	}
+
+	clusterFound := false
+	for _, item := range c.Clusters {
+		if item.Name == context.Cluster {
+			cluster, clusterFound = item.Data, true
+		}
+	}
+	if !clusterFound {
+		err = fmt.Errorf("kubernetes: cluster %q not found", context.Cluster)
+		return
+	}
+
+	// A context without user doesn't authenticate
+	for _, item := range c.Users {
+		if item.Name == context.User {
+			user = item.Data
+		}
+	}
+	return
+}
+
+// Reads a kubeconfig file, its relative paths are resolved against the directory of the file
+func readKubeConfigFile(path string) (kubeConfig KubeConf, err error) {
+	yamlFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err = yaml.Unmarshal(yamlFile, &kubeConfig); err != nil {
+		return
+	}
+
+	dir := filepath.Dir(path)
+	for k := range kubeConfig.Clusters {
+		cluster := &kubeConfig.Clusters[k].Data
+		cluster.CertificateAuthority = resolvePath(dir, cluster.CertificateAuthority)
+	}
+	for k := range kubeConfig.Users {
+		user := &kubeConfig.Users[k].Data
+		user.ClientCertificate = resolvePath(dir, user.ClientCertificate)
+		user.ClientKey = resolvePath(dir, user.ClientKey)
+		user.TokenFile = resolvePath(dir, user.TokenFile)
+		if user.Exec != nil && strings.ContainsRune(user.Exec.Command, filepath.Separator) { // Otherwise looked up in the PATH
+			user.Exec.Command = resolvePath(dir, user.Exec.Command)
+		}
+	}
+	return
+}
+
+// Merges kubeconfig files like kubectl: the first file setting the current-context
+// or defining a cluster, a context or a user by its name wins
+func mergeKubeConfigs(configs []KubeConf) (merged KubeConf) {
+	clusters, contexts, users := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, config := range configs {
+		if merged.ApiVersion == "" {
+			merged.ApiVersion, merged.Kind = config.ApiVersion, config.Kind
+		}
+		if merged.CurrentContext == "" {
+			merged.CurrentContext = config.CurrentContext
+		}
+		for _, cluster := range config.Clusters {
+			if !clusters[cluster.Name] {
+				clusters[cluster.Name] = true
+				merged.Clusters = append(merged.Clusters, cluster)
+			}
+		}
+		for _, context := range config.Contexts {
+			if !contexts[context.Name] {
+				contexts[context.Name] = true
+				merged.Contexts = append(merged.Contexts, context)
+			}
+		}
+		for _, user := range config.Users {
+			if !users[user.Name] {
+				users[user.Name] = true
+				merged.Users = append(merged.Users, user)
+			}
+		}
+	}
+	return
+}
+
+// Decodes the certificates of a cluster and a user, or reads them from their files.
+// The other entries aren't loaded, they may reference files of other machines.
+func (c *KubeConf) loadCertificates(clusterName, userName string) (err error) {
+	for k := range c.Clusters {
+		if c.Clusters[k].Name != clusterName {
+			continue
+		}
+		cluster := &c.Clusters[k].Data
+		cluster.CertificateAuthorityData, err = readKubeConfigData(cluster.CertificateAuthorityDataStr, cluster.CertificateAuthority)
+		if err != nil {
+			return fmt.Errorf("kubernetes: cluster %s: certificate authority: %s", clusterName, err)
+		}
+	}
+
+	for k := range c.Users {
+		if c.Users[k].Name != userName {
+			continue
+		}
+		user := &c.Users[k].Data
+		user.ClientCertificateData, err = readKubeConfigData(user.ClientCertificateDataStr, user.ClientCertificate)
+		if err != nil {
+			return fmt.Errorf("kubernetes: user %s: client certificate: %s", userName, err)
+		}
+		user.ClientKeyData, err = readKubeConfigData(user.ClientKeyDataStr, user.ClientKey)
+		if err != nil {
+			return fmt.Errorf("kubernetes: user %s: client key: %s", userName, err)
+		}
+	}
+	return
+}
+
+// Returns the base64 encoded data of a kubeconfig entry, or else the content of the file referenced by the entry
+func readKubeConfigData(data, file string) ([]byte, error) {
+	if data != "" || file == "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	return ioutil.ReadFile(file)
 }
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const microTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// Time with microseconds, as serialized by the Lease objects
+type KubeMicroTime struct {
+	time.Time
+}
+
+func (t KubeMicroTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.UTC().Format(microTimeLayout))
+}
+
+func (t *KubeMicroTime) UnmarshalJSON(data []byte) (err error) {
+	if string(data) == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	var value string
+	if err = json.Unmarshal(data, &value); err != nil {
+		return
+	}
+	t.Time, err = time.Parse(microTimeLayout, value)
+	if err != nil { // Some servers drop the microseconds
+		t.Time, err = time.Parse(time.RFC3339, value)
+	}
+	return
+}
+
+// coordination.k8s.io/v1 Lease, used for leader election
+type KubeLease struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string        `json:"holderIdentity"`
+		LeaseDurationSeconds int           `json:"leaseDurationSeconds"`
+		AcquireTime          KubeMicroTime `json:"acquireTime"`
+		RenewTime            KubeMicroTime `json:"renewTime"`
+		LeaseTransitions     int           `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// Returns ErrNotFound when the lease doesn't exist
+func (api KubernetesCoreV1Api) GetNamespacedLease(ctx context.Context, namespace, name string) (lease KubeLease, err error) {
+	return api.leaseRequest(ctx, "GET", fmt.Sprintf("apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", namespace, name), nil)
+}
+
+// Returns ErrConflict when the lease already exists
+func (api KubernetesCoreV1Api) CreateNamespacedLease(ctx context.Context, lease KubeLease) (created KubeLease, err error) {
+	return api.leaseRequest(ctx, "POST", fmt.Sprintf("apis/coordination.k8s.io/v1/namespaces/%s/leases", lease.Metadata.Namespace), &lease)
+}
+
+// Updates the lease if its resourceVersion is still the current one, returns ErrConflict otherwise
+func (api KubernetesCoreV1Api) ReplaceNamespacedLease(ctx context.Context, lease KubeLease) (replaced KubeLease, err error) {
+	return api.leaseRequest(ctx, "PUT", fmt.Sprintf("apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", lease.Metadata.Namespace, lease.Metadata.Name), &lease)
+}
+
+func (api KubernetesCoreV1Api) leaseRequest(ctx context.Context, httpMethod, endpoint string, lease *KubeLease) (result KubeLease, err error) {
+	var body io.Reader
+	if lease != nil {
+		lease.Kind, lease.APIVersion = "Lease", "coordination.k8s.io/v1"
+		data, err := json.Marshal(lease)
+		if err != nil {
+			return result, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	response, err := api.RequestWithContext(ctx, httpMethod, endpoint, "", nil, body)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case 200, 201:
+		err = json.NewDecoder(response.Body).Decode(&result)
+	case 404:
+		err = ErrNotFound
+	case 409:
+		err = ErrConflict
+	default:
+		kubeResponse := KubeResponse{}
+		json.NewDecoder(response.Body).Decode(&kubeResponse)
+		err = fmt.Errorf("kubernetes: %s %s error code %d: %s", httpMethod, endpoint, response.StatusCode, kubeResponse.Message)
+	}
+	return
+}
@@ -23,20 +23,31 @@ type KubeNode struct {
 }
 
 type KubeNodeMetadata struct {
-	Name              string `json:"name"`
-	SelfLink          string `json:"selfLink"`
-	Uid               string `json:"uid"`
-	ResourceVersion   string `json:"resourceVersion"`
-	CreationTimestamp string `json:"creationTimestamp"`
+	Name              string            `json:"name"`
+	SelfLink          string            `json:"selfLink"`
+	Uid               string            `json:"uid"`
+	ResourceVersion   string            `json:"resourceVersion"`
+	CreationTimestamp string            `json:"creationTimestamp"`
+	Labels            map[string]string `json:"labels"`
 }
 
 type KubeNodeSpec struct {
-	PodCIDR    string `json:"podCIDR"`
-	ExternalID string `json:"externalID"`
+	PodCIDR    string      `json:"podCIDR"`
+	ExternalID string      `json:"externalID"`
+	Taints     []KubeTaint `json:"taints"`
+}
+
+type KubeTaint struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Effect    string `json:"effect"` // NoSchedule, PreferNoSchedule or NoExecute
+	TimeAdded string `json:"timeAdded"`
 }
 
 type KubeNodeStatus struct {
-	Conditions []KubeNodeStatusConditions `json:"conditions"`
+	Capacity    map[string]string          `json:"capacity"`
+	Allocatable map[string]string          `json:"allocatable"`
+	Conditions  []KubeNodeStatusConditions `json:"conditions"`
 }
 
 type KubeNodeStatusConditions struct {
@@ -0,0 +1,120 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Node resource usage served by the metrics-server (metrics.k8s.io/v1beta1)
+type KubeNodeMetrics struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Metadata   struct {
+		Name              string    `json:"name"`
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Timestamp time.Time         `json:"timestamp"`
+	Window    string            `json:"window"`
+	Usage     map[string]string `json:"usage"`
+}
+
+func (api KubernetesCoreV1Api) GetNodeMetrics(ctx context.Context, node string) (nodeMetrics KubeNodeMetrics, err error) {
+	response, err := api.RequestWithContext(ctx, "GET", "apis/metrics.k8s.io/v1beta1/nodes/"+node, "", nil, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		err = fmt.Errorf("kubernetes: GetNodeMetrics error code %d, is the metrics-server running?", response.StatusCode)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&nodeMetrics)
+	return
+}
+
+// Returns the resource usage of a node reported by the metrics-server.
+//
+// - node:
+// 		The Kubernetes node name.
+//
+// - query:
+// 		The resource to retrieve:
+// 		"cpu" (cores), "memory" (bytes), "cpu.used.percent" and "memory.used.percent" (usage over the node allocatable).
+func (api KubernetesCoreV1Api) NodeMetric(ctx context.Context, node, query string) (metricValue float64, err error) {
+	var resource string
+	var percent bool
+	switch query {
+	case "cpu", "memory":
+		resource = query
+	case "cpu.used.percent":
+		resource, percent = "cpu", true
+	case "memory.used.percent":
+		resource, percent = "memory", true
+	default:
+		err = fmt.Errorf("kubernetes: unsupported node metric %q", query)
+		return
+	}
+
+	nodeMetrics, err := api.GetNodeMetrics(ctx, node)
+	if err != nil {
+		return
+	}
+	usage, ok := nodeMetrics.Usage[resource]
+	if !ok {
+		err = fmt.Errorf("kubernetes: no %s usage reported for node %s", resource, node)
+		return
+	}
+	metricValue, err = ParseQuantity(usage)
+	if err != nil || !percent {
+		return
+	}
+
+	allocatable, err := api.nodeAllocatable(node, resource)
+	if err != nil {
+		return
+	}
+	return metricValue * 100 / allocatable, nil
+}
+
+// Returns the allocatable amount of a resource in a node
+func (api KubernetesCoreV1Api) nodeAllocatable(node, resource string) (allocatable float64, err error) {
+	nodes, err := api.ListNodes()
+	if err != nil {
+		return
+	}
+	for _, n := range nodes {
+		if n.Metadata.Name != node {
+			continue
+		}
+		quantity, ok := n.Status.Allocatable[resource]
+		if !ok {
+			break
+		}
+		allocatable, err = ParseQuantity(quantity)
+		if err == nil && allocatable == 0 {
+			err = fmt.Errorf("kubernetes: node %s has no allocatable %s", node, resource)
+		}
+		return
+	}
+	return 0, fmt.Errorf("kubernetes: allocatable %s of node %s not found", resource, node)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+// Bounds the walk of the controller chain in case of an ownership cycle
+const maxOwnerDepth = 8
+
+type KubeOwnerReference struct {
+	APIVersion         string `json:"apiVersion"`
+	Kind               string `json:"kind"`
+	Name               string `json:"name"`
+	UID                string `json:"uid"`
+	Controller         bool   `json:"controller"`
+	BlockOwnerDeletion bool   `json:"blockOwnerDeletion"`
+}
+
+// The top-level controller of a pod (a Deployment, a StatefulSet, a CronJob...), a bare pod is its own workload
+type KubeWorkload struct {
+	Kind      string
+	Name      string
+	Namespace string
+	UID       string
+}
+
+func (w KubeWorkload) String() string {
+	return w.Kind + "/" + w.Namespace + "/" + w.Name
+}
+
+// Returns the managing controller among the owner references, ok is false when there is none
+func ControllerOf(references []KubeOwnerReference) (controller KubeOwnerReference, ok bool) {
+	for _, reference := range references {
+		if reference.Controller {
+			return reference, true
+		}
+	}
+	return
+}
+
+// Walks the controller chain of a pod up to its top-level controller:
+// ReplicaSet -> Deployment, Job -> CronJob, StatefulSet, DaemonSet and ReplicationController.
+// The controllers of unknown kinds (custom resources) end the walk.
+// On error, the workload is the last controller resolved.
+func (api KubernetesCoreV1Api) ResolvePodWorkload(pod KubePod) (workload KubeWorkload, err error) {
+	namespace := pod.Metadata.Namespace
+	workload = KubeWorkload{Kind: "Pod", Name: pod.Metadata.Name, Namespace: namespace, UID: pod.Metadata.UID}
+	references := pod.Metadata.OwnerReferences
+
+	for depth := 0; depth < maxOwnerDepth; depth++ {
+		controller, ok := ControllerOf(references)
+		if !ok {
+			return
+		}
+		workload = KubeWorkload{Kind: controller.Kind, Name: controller.Name, Namespace: namespace, UID: controller.UID}
+
+		switch controller.Kind {
+		case "ReplicaSet":
+			replicaSet, err := api.ListNamespacedReplicaset(namespace, controller.Name)
+			if err != nil {
+				return workload, err
+			}
+			references = replicaSet.Metadata.OwnerReferences
+		case "StatefulSet":
+			statefulSet, err := api.GetNamespacedStatefulSet(namespace, controller.Name)
+			if err != nil {
+				return workload, err
+			}
+			references = statefulSet.Metadata.OwnerReferences
+		case "DaemonSet":
+			daemonSet, err := api.GetNamespacedDaemonSet(namespace, controller.Name)
+			if err != nil {
+				return workload, err
+			}
+			references = daemonSet.Metadata.OwnerReferences
+		case "Job":
+			job, err := api.GetNamespacedJob(namespace, controller.Name)
+			if err != nil {
+				return workload, err
+			}
+			references = job.Metadata.OwnerReferences
+		case "CronJob":
+			cronJob, err := api.GetNamespacedCronJob(namespace, controller.Name)
+			if err != nil {
+				return workload, err
+			}
+			references = cronJob.Metadata.OwnerReferences
+		case "ReplicationController":
+			replicationController, err := api.GetNamespacedReplicationController(namespace, controller.Name)
+			if err != nil {
+				return workload, err
+			}
+			references = replicationController.Metadata.OwnerReferences
+		default: // Deployments and custom resources
+			return
+		}
+	}
+	return
+}
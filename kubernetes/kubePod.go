@@ -28,22 +28,17 @@ type KubePod struct {
 	Kind       string `json:"kind"`
 	APIVersion string `json:"apiVersion"`
 	Metadata struct {
-		Name              string            `json:"name"`
-		GenerateName      string            `json:"generateName"`
-		Namespace         string            `json:"namespace"`
-		SelfLink          string            `json:"selfLink"`
-		UID               string            `json:"uid"`
-		ResourceVersion   string            `json:"resourceVersion"`
-		CreationTimestamp time.Time         `json:"creationTimestamp"`
-		Labels            map[string]string `json:"labels"`
-		OwnerReferences []struct {
-			APIVersion         string `json:"apiVersion"`
-			Kind               string `json:"kind"`
-			Name               string `json:"name"`
-			UID                string `json:"uid"`
-			Controller         bool   `json:"controller"`
-			BlockOwnerDeletion bool   `json:"blockOwnerDeletion"`
-		} `json:"ownerReferences"`
+		Name              string               `json:"name"`
+		GenerateName      string               `json:"generateName"`
+		Namespace         string               `json:"namespace"`
+		SelfLink          string               `json:"selfLink"`
+		UID               string               `json:"uid"`
+		ResourceVersion   string               `json:"resourceVersion"`
+		CreationTimestamp time.Time            `json:"creationTimestamp"`
+		DeletionTimestamp *time.Time           `json:"deletionTimestamp"`
+		Labels            map[string]string    `json:"labels"`
+		Annotations       map[string]string    `json:"annotations"`
+		OwnerReferences   []KubeOwnerReference `json:"ownerReferences"`
 	} `json:"metadata"`
 	Spec struct {
 		Volumes []struct {
@@ -53,43 +48,28 @@ type KubePod struct {
 				DefaultMode int    `json:"defaultMode"`
 			} `json:"secret"`
 		} `json:"volumes"`
-		Containers []struct {
-			Name  string `json:"name"`
-			Image string `json:"image"`
-			Ports []struct {
-				Name          string `json:"name"`
-				ContainerPort int    `json:"containerPort"`
-				Protocol      string `json:"protocol"`
-			} `json:"ports"`
-			Resources struct {
-			} `json:"resources"`
-			VolumeMounts []struct {
-				Name      string `json:"name"`
-				ReadOnly  bool   `json:"readOnly"`
-				MountPath string `json:"mountPath"`
-			} `json:"volumeMounts"`
-			TerminationMessagePath   string `json:"terminationMessagePath"`
-			TerminationMessagePolicy string `json:"terminationMessagePolicy"`
-			ImagePullPolicy          string `json:"imagePullPolicy"`
-		} `json:"containers"`
-		RestartPolicy                 string `json:"restartPolicy"`
-		TerminationGracePeriodSeconds int    `json:"terminationGracePeriodSeconds"`
-		DNSPolicy                     string `json:"dnsPolicy"`
-		ServiceAccountName            string `json:"serviceAccountName"`
-		ServiceAccount                string `json:"serviceAccount"`
-		NodeName                      string `json:"nodeName"`
+		InitContainers                []KubeContainer `json:"initContainers"`
+		Containers                    []KubeContainer `json:"containers"`
+		RestartPolicy                 string          `json:"restartPolicy"`
+		TerminationGracePeriodSeconds int             `json:"terminationGracePeriodSeconds"`
+		DNSPolicy                     string          `json:"dnsPolicy"`
+		ServiceAccountName            string          `json:"serviceAccountName"`
+		ServiceAccount                string          `json:"serviceAccount"`
+		NodeName                      string          `json:"nodeName"`
 		SecurityContext struct {
 		} `json:"securityContext"`
-		SchedulerName string `json:"schedulerName"`
-		Tolerations []struct {
-			Key               string `json:"key"`
-			Operator          string `json:"operator"`
-			Effect            string `json:"effect"`
-			TolerationSeconds int    `json:"tolerationSeconds"`
-		} `json:"tolerations"`
+		SchedulerName             string                         `json:"schedulerName"`
+		Priority                  int                            `json:"priority"`
+		PriorityClassName         string                         `json:"priorityClassName"`
+		PreemptionPolicy          string                         `json:"preemptionPolicy"`
+		Tolerations               []KubeToleration               `json:"tolerations"`
+		NodeSelector              map[string]string              `json:"nodeSelector"`
+		Affinity                  KubeAffinity                   `json:"affinity"`
+		TopologySpreadConstraints []KubeTopologySpreadConstraint `json:"topologySpreadConstraints"`
 	} `json:"spec"`
 	Status struct {
-		Phase string `json:"phase"`
+		Phase             string `json:"phase"`
+		NominatedNodeName string `json:"nominatedNodeName"`
 		Conditions []struct {
 			Type               string      `json:"type"`
 			Status             string      `json:"status"`
@@ -117,3 +97,62 @@ type KubePod struct {
 		QosClass string `json:"qosClass"`
 	} `json:"status"`
 }
+
+type KubeToleration struct {
+	Key               string `json:"key"`
+	Operator          string `json:"operator"` // Equal (default) or Exists
+	Value             string `json:"value"`
+	Effect            string `json:"effect"` // Empty matches all the effects
+	TolerationSeconds int    `json:"tolerationSeconds"`
+}
+
+// Checks if the toleration matches the taint. An empty key with the Exists operator matches all the taints.
+func (t KubeToleration) ToleratesTaint(taint KubeTaint) bool {
+	if t.Effect != "" && t.Effect != taint.Effect {
+		return false
+	}
+	if t.Key != "" && t.Key != taint.Key {
+		return false
+	}
+
+	switch t.Operator {
+	case "Exists":
+		return true
+	case "", "Equal":
+		return t.Key != "" && t.Value == taint.Value
+	}
+	return false
+}
+
+// Limits the skew of the matching pods between the topology domains
+type KubeTopologySpreadConstraint struct {
+	MaxSkew           int                `json:"maxSkew"`
+	TopologyKey       string             `json:"topologyKey"`
+	WhenUnsatisfiable string             `json:"whenUnsatisfiable"` // DoNotSchedule or ScheduleAnyway
+	LabelSelector     *KubeLabelSelector `json:"labelSelector"`
+}
+
+type KubeContainer struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	Ports []struct {
+		Name          string `json:"name"`
+		ContainerPort int    `json:"containerPort"`
+		Protocol      string `json:"protocol"`
+	} `json:"ports"`
+	Resources    KubeResourceRequirements `json:"resources"`
+	VolumeMounts []struct {
+		Name      string `json:"name"`
+		ReadOnly  bool   `json:"readOnly"`
+		MountPath string `json:"mountPath"`
+	} `json:"volumeMounts"`
+	TerminationMessagePath   string `json:"terminationMessagePath"`
+	TerminationMessagePolicy string `json:"terminationMessagePolicy"`
+	ImagePullPolicy          string `json:"imagePullPolicy"`
+}
+
+// Resource quantities by resource name ("cpu", "memory", "ephemeral-storage"...)
+type KubeResourceRequirements struct {
+	Limits   map[string]string `json:"limits"`
+	Requests map[string]string `json:"requests"`
+}
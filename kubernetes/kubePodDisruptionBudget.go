@@ -0,0 +1,42 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+type KubePodDisruptionBudget struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Metadata   struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Selector       *KubeLabelSelector `json:"selector"`
+		MinAvailable   interface{}        `json:"minAvailable"`
+		MaxUnavailable interface{}        `json:"maxUnavailable"`
+	} `json:"spec"`
+	Status struct {
+		DisruptionsAllowed int `json:"disruptionsAllowed"`
+		CurrentHealthy     int `json:"currentHealthy"`
+		DesiredHealthy     int `json:"desiredHealthy"`
+		ExpectedPods       int `json:"expectedPods"`
+	} `json:"status"`
+}
+
+// Checks if the budget covers the pod
+func (pdb KubePodDisruptionBudget) MatchesPod(pod KubePod) bool {
+	return pdb.Metadata.Namespace == pod.Metadata.Namespace && pdb.Spec.Selector.Matches(pod.Metadata.Labels)
+}
@@ -22,23 +22,16 @@ type KubeReplicaSet struct {
 	Kind       string `json:"kind"`
 	APIVersion string `json:"apiVersion"`
 	Metadata struct {
-		Name              string            `json:"name"`
-		Namespace         string            `json:"namespace"`
-		SelfLink          string            `json:"selfLink"`
-		UID               string            `json:"uid"`
-		ResourceVersion   string            `json:"resourceVersion"`
-		Generation        int               `json:"generation"`
-		CreationTimestamp time.Time         `json:"creationTimestamp"`
-		Labels            map[string]string `json:"labels"`
-		Annotations       map[string]string `json:"annotations"`
-		OwnerReferences []struct {
-			APIVersion         string `json:"apiVersion"`
-			Kind               string `json:"kind"`
-			Name               string `json:"name"`
-			UID                string `json:"uid"`
-			Controller         bool   `json:"controller"`
-			BlockOwnerDeletion bool   `json:"blockOwnerDeletion"`
-		} `json:"ownerReferences"`
+		Name              string               `json:"name"`
+		Namespace         string               `json:"namespace"`
+		SelfLink          string               `json:"selfLink"`
+		UID               string               `json:"uid"`
+		ResourceVersion   string               `json:"resourceVersion"`
+		Generation        int                  `json:"generation"`
+		CreationTimestamp time.Time            `json:"creationTimestamp"`
+		Labels            map[string]string    `json:"labels"`
+		Annotations       map[string]string    `json:"annotations"`
+		OwnerReferences   []KubeOwnerReference `json:"ownerReferences"`
 	} `json:"metadata"`
 	Spec struct {
 		Replicas int `json:"replicas"`
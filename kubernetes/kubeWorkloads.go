@@ -0,0 +1,153 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Metadata shared by the workload objects
+type KubeObjectMeta struct {
+	Name              string               `json:"name"`
+	Namespace         string               `json:"namespace"`
+	UID               string               `json:"uid"`
+	ResourceVersion   string               `json:"resourceVersion"`
+	Generation        int                  `json:"generation"`
+	CreationTimestamp time.Time            `json:"creationTimestamp"`
+	Labels            map[string]string    `json:"labels"`
+	Annotations       map[string]string    `json:"annotations"`
+	OwnerReferences   []KubeOwnerReference `json:"ownerReferences"`
+}
+
+type KubeStatefulSet struct {
+	Kind       string         `json:"kind"`
+	APIVersion string         `json:"apiVersion"`
+	Metadata   KubeObjectMeta `json:"metadata"`
+	Spec       struct {
+		Replicas    int                `json:"replicas"`
+		ServiceName string             `json:"serviceName"`
+		Selector    *KubeLabelSelector `json:"selector"`
+	} `json:"spec"`
+	Status struct {
+		Replicas      int `json:"replicas"`
+		ReadyReplicas int `json:"readyReplicas"`
+	} `json:"status"`
+}
+
+type KubeDaemonSet struct {
+	Kind       string         `json:"kind"`
+	APIVersion string         `json:"apiVersion"`
+	Metadata   KubeObjectMeta `json:"metadata"`
+	Spec       struct {
+		Selector *KubeLabelSelector `json:"selector"`
+	} `json:"spec"`
+	Status struct {
+		DesiredNumberScheduled int `json:"desiredNumberScheduled"`
+		CurrentNumberScheduled int `json:"currentNumberScheduled"`
+		NumberReady            int `json:"numberReady"`
+	} `json:"status"`
+}
+
+type KubeJob struct {
+	Kind       string         `json:"kind"`
+	APIVersion string         `json:"apiVersion"`
+	Metadata   KubeObjectMeta `json:"metadata"`
+	Spec       struct {
+		Parallelism *int               `json:"parallelism"`
+		Completions *int               `json:"completions"`
+		Selector    *KubeLabelSelector `json:"selector"`
+	} `json:"spec"`
+	Status struct {
+		Active    int `json:"active"`
+		Succeeded int `json:"succeeded"`
+		Failed    int `json:"failed"`
+	} `json:"status"`
+}
+
+type KubeCronJob struct {
+	Kind       string         `json:"kind"`
+	APIVersion string         `json:"apiVersion"`
+	Metadata   KubeObjectMeta `json:"metadata"`
+	Spec       struct {
+		Schedule string `json:"schedule"`
+		Suspend  *bool  `json:"suspend"`
+	} `json:"spec"`
+	Status struct {
+		LastScheduleTime *time.Time `json:"lastScheduleTime"`
+	} `json:"status"`
+}
+
+type KubeReplicationController struct {
+	Kind       string         `json:"kind"`
+	APIVersion string         `json:"apiVersion"`
+	Metadata   KubeObjectMeta `json:"metadata"`
+	Spec       struct {
+		Replicas int               `json:"replicas"`
+		Selector map[string]string `json:"selector"`
+	} `json:"spec"`
+	Status struct {
+		Replicas      int `json:"replicas"`
+		ReadyReplicas int `json:"readyReplicas"`
+	} `json:"status"`
+}
+
+func (api KubernetesCoreV1Api) GetNamespacedStatefulSet(namespace, name string) (statefulSet KubeStatefulSet, err error) {
+	err = api.getNamespacedObject(fmt.Sprintf("apis/apps/v1/namespaces/%s/statefulsets/%s", namespace, name), &statefulSet)
+	return
+}
+
+func (api KubernetesCoreV1Api) GetNamespacedDaemonSet(namespace, name string) (daemonSet KubeDaemonSet, err error) {
+	err = api.getNamespacedObject(fmt.Sprintf("apis/apps/v1/namespaces/%s/daemonsets/%s", namespace, name), &daemonSet)
+	return
+}
+
+func (api KubernetesCoreV1Api) GetNamespacedJob(namespace, name string) (job KubeJob, err error) {
+	err = api.getNamespacedObject(fmt.Sprintf("apis/batch/v1/namespaces/%s/jobs/%s", namespace, name), &job)
+	return
+}
+
+func (api KubernetesCoreV1Api) GetNamespacedCronJob(namespace, name string) (cronJob KubeCronJob, err error) {
+	err = api.getNamespacedObject(fmt.Sprintf("apis/batch/v1/namespaces/%s/cronjobs/%s", namespace, name), &cronJob)
+	return
+}
+
+func (api KubernetesCoreV1Api) GetNamespacedReplicationController(namespace, name string) (controller KubeReplicationController, err error) {
+	err = api.getNamespacedObject(fmt.Sprintf("api/v1/namespaces/%s/replicationcontrollers/%s", namespace, name), &controller)
+	return
+}
+
+// Gets an object from the endpoint and decodes it in object, returns ErrNotFound when it doesn't exist
+func (api KubernetesCoreV1Api) getNamespacedObject(endpoint string, object interface{}) (err error) {
+	response, err := api.Request("GET", endpoint, "", nil, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == 404 {
+		return ErrNotFound
+	}
+	if response.StatusCode != 200 {
+		kubeResponse := KubeResponse{}
+		json.NewDecoder(response.Body).Decode(&kubeResponse)
+		return fmt.Errorf("kubernetes: GET %s error code %d: %s", endpoint, response.StatusCode, kubeResponse.Message)
+	}
+
+	return json.NewDecoder(response.Body).Decode(object)
+}
@@ -21,87 +21,46 @@ import (
 	"bufio"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"time"
-	"net"
 	"context"
 	"bytes"
+)
 
-	"gopkg.in/yaml.v2"
-	"github.com/draios/kubernetes-scheduler/cache"
+// Errors
+var (
+	ErrNotFound = errors.New("kubernetes: not found")
+	ErrConflict = errors.New("kubernetes: conflict")
 )
 
 type KubernetesCoreV1Api struct {
 	config       KubeConf
-	nodeList     cache.Cache
+	nodeInformer NodeInformer // Serves ListNodes once it runs and is synced
 	clientCert   tls.Certificate
 	serverCaCert *x509.CertPool
-}
-
-func (api KubernetesCoreV1Api) ReplaceDeploymentScheduler(item KubeDeploymentItem, scheduler string) (modified KubeDeploymentItem, err error) {
-	url := fmt.Sprintf("apis/apps/v1/namespaces/%s/deployments/%s", item.Metadata.Namespace, item.Metadata.Name)
-
-	patchRequest := []struct {
-		Op    string `json:"op"`
-		Path  string `json:"path"`
-		Value string `json:"value,omitempty"`
-	}{{
-		Op:    "add",
-		Path:  "/spec/template/spec/schedulerName",
-		Value: scheduler,
-	}}
-
-	data, err := json.Marshal(patchRequest)
-	if err != nil {
-		return
-	}
-	body := bytes.NewReader(data)
-
-	response, err := api.Request("PATCH", url, "application/json-patch+json", nil, body)
-	if err != nil {
-		return
-	}
-	defer response.Body.Close()
-
-	if response.StatusCode != 200 {
-		var responseData struct {
-			Message string `json:"message"`
-		}
-		json.NewDecoder(response.Body).Decode(&responseData)
-		err = fmt.Errorf("kubernetes: ReplaceDeploymentScheduler error code %d: %s", response.StatusCode, responseData.Message)
-		return
-	}
-
-	err = json.NewDecoder(response.Body).Decode(&modified)
-	return
-}
-
-func (api KubernetesCoreV1Api) ListNamespacedDeployments(namespace, fieldSelector string) (deployments KubeDeployments, err error) {
-
-	values := url.Values{}
-	values.Add("fieldSelector", fieldSelector)
-
-	response, err := api.Request("GET", fmt.Sprintf("apis/apps/v1/namespaces/%s/deployments", namespace), "", values, nil)
-	if err != nil {
-		return
-	}
-	defer response.Body.Close()
-
-	err = json.NewDecoder(response.Body).Decode(&deployments)
-	return
+	client       *http.Client // Shared by the requests and the copies of the api, built by loadTLSInfo
+	tokenSource  tokenSource // Bearer token of the requests, if any
+	username     string      // Basic authentication, if any
+	password     string
+	namespace    string      // Default namespace of the current context
+
+	insecureSkipTLSVerify bool   // Don't verify the server certificate
+	tlsServerName         string // Name checked in the server certificate, the server host when empty
 }
 
 func (api KubernetesCoreV1Api) CreateNamespacedBinding(namespace string, body io.Reader) (response *http.Response, err error) {
 	return api.Request("POST", fmt.Sprintf("api/v1/namespaces/%s/bindings", namespace), "", nil, body)
 }
 
+// Streams the lines of a single watch, the channel is closed when the watch ends or fails.
+// Use ListWatch to follow the objects without missing changes.
 func (api KubernetesCoreV1Api) Watch(httpMethod, apiMethod string, values url.Values, body io.Reader) (responseChannel chan []byte, err error) {
 	if values == nil {
 		values = url.Values{}
@@ -115,13 +74,16 @@ func (api KubernetesCoreV1Api) Watch(httpMethod, apiMethod string, values url.Va
 			return
 		}
 		defer response.Body.Close()
+		defer close(responseChannel)
 
 		reader := bufio.NewReader(response.Body)
 		for {
 			line, err := reader.ReadBytes('\n')
 			if err != nil {
-				log.Println(err)
-				continue
+				if err != io.EOF {
+					log.Println(err)
+				}
+				return
 			}
 			responseChannel <- line
 			line = nil
@@ -131,23 +93,18 @@ func (api KubernetesCoreV1Api) Watch(httpMethod, apiMethod string, values url.Va
 }
 
 func (api KubernetesCoreV1Api) Request(httpMethod, apiMethod, contentType string, values url.Values, body io.Reader) (response *http.Response, err error) {
-	apiUrl := api.currentApiUrlEndpoint()
+	return api.RequestWithContext(context.Background(), httpMethod, apiMethod, contentType, values, body)
+}
 
-	certificate, caCertPool := api.currentTLSInfo()
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{certificate},
-		RootCAs:      caCertPool,
-	}
+// Same as Request, the request is aborted when the context is done
+func (api KubernetesCoreV1Api) RequestWithContext(ctx context.Context, httpMethod, apiMethod, contentType string, values url.Values, body io.Reader) (response *http.Response, err error) {
+	apiUrl := api.currentApiUrlEndpoint()
 
-	tlsConfig.BuildNameToCertificate()
-	transport := &http.Transport{TLSClientConfig: tlsConfig, DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-		return net.DialTimeout(network, addr, 10*time.Second)
-	}}
-	client := http.Client{Transport: transport}
 	request, err := http.NewRequest(httpMethod, apiUrl+"/"+apiMethod, body)
 	if err != nil {
 		return
 	}
+	request = request.WithContext(ctx)
 	if values != nil {
 		request.URL.RawQuery = values.Encode()
 	}
@@ -158,15 +115,26 @@ func (api KubernetesCoreV1Api) Request(httpMethod, apiMethod, contentType string
 	}
 	request.Header.Add("Content-Type", contentType)
 
+	if api.tokenSource != nil {
+		token, err := api.tokenSource.Token()
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	} else if api.username != "" {
+		request.SetBasicAuth(api.username, api.password)
+	}
+
 	// Make the request
-	response, err = client.Do(request)
+	response, err = api.client.Do(request)
 	return
 }
 
+// Lists the nodes from the store of the node informer when it is synced, from the API server otherwise
 func (api KubernetesCoreV1Api) ListNodes() (nodes []KubeNode, err error) {
 
-	if nodes, ok := api.nodeList.Data(); ok {
-		return nodes.([]KubeNode), nil
+	if api.nodeInformer.Informer != nil && api.nodeInformer.HasSynced() {
+		return api.nodeInformer.List(), nil
 	}
 
 	response, err := api.Request("GET", "api/v1/nodes", "", nil, nil)
@@ -183,64 +151,235 @@ func (api KubernetesCoreV1Api) ListNodes() (nodes []KubeNode, err error) {
 		return
 	}
 	nodes = nodeInfo.Items
+	return
+}
+
+// Lists the pods of all the namespaces matching the field selector
+func (api KubernetesCoreV1Api) ListPods(fieldSelector string) (pods []KubePod, err error) {
+	values := url.Values{}
+	if fieldSelector != "" {
+		values.Add("fieldSelector", fieldSelector)
+	}
+
+	response, err := api.Request("GET", "api/v1/pods", "", values, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		err = fmt.Errorf("kubernetes: ListPods error code %d", response.StatusCode)
+		return
+	}
 
-	api.nodeList.SetData(nodes)
+	var podList struct {
+		Items []KubePod `json:"items"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&podList)
+	pods = podList.Items
+	return
+}
 
+// Returns ErrNotFound when the pod doesn't exist
+func (api KubernetesCoreV1Api) GetNamespacedPod(namespace, name string) (pod KubePod, err error) {
+	err = api.getNamespacedObject(fmt.Sprintf("api/v1/namespaces/%s/pods/%s", namespace, name), &pod)
 	return
 }
 
-// Reads the configuration file and loads the config struct
-func (api *KubernetesCoreV1Api) LoadKubeConfig() (err error) {
-	yamlFile, err := ioutil.ReadFile(getKubeConfigFileDefaultLocation())
+// Lists the PodDisruptionBudgets of all the namespaces
+func (api KubernetesCoreV1Api) ListPodDisruptionBudgets() (pdbs []KubePodDisruptionBudget, err error) {
+	response, err := api.Request("GET", "apis/policy/v1/poddisruptionbudgets", "", nil, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		err = fmt.Errorf("kubernetes: ListPodDisruptionBudgets error code %d", response.StatusCode)
+		return
+	}
+
+	var pdbList struct {
+		Items []KubePodDisruptionBudget `json:"items"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&pdbList)
+	pdbs = pdbList.Items
+	return
+}
+
+// Evicts a pod through the Eviction API, the eviction is refused when it would violate a PodDisruptionBudget
+func (api KubernetesCoreV1Api) EvictNamespacedPod(namespace, name string) (err error) {
+	eviction := map[string]interface{}{
+		"apiVersion": "policy/v1",
+		"kind":       "Eviction",
+		"metadata": map[string]string{
+			"name":      name,
+			"namespace": namespace,
+		},
+	}
+	data, err := json.Marshal(eviction)
 	if err != nil {
-		panic("Could not load the Kubernetes configuration")
+		return
 	}
 
-	var kubeConfig KubeConf
-	err = yaml.Unmarshal(yamlFile, &kubeConfig)
+	response, err := api.Request("POST", fmt.Sprintf("api/v1/namespaces/%s/pods/%s/eviction", namespace, name), "", nil, bytes.NewReader(data))
 	if err != nil {
-		return err
+		return
 	}
+	defer response.Body.Close()
 
-	// Decode the certificate
-	for k, cluster := range kubeConfig.Clusters {
-		certBytes, err := base64.StdEncoding.DecodeString(cluster.Data.CertificateAuthorityDataStr)
-		if err != nil {
-			panic(err)
-		}
-		cluster.Data.CertificateAuthorityData = certBytes
-		kubeConfig.Clusters[k] = cluster
+	if response.StatusCode != 200 && response.StatusCode != 201 {
+		kubeResponse := KubeResponse{}
+		json.NewDecoder(response.Body).Decode(&kubeResponse)
+		err = fmt.Errorf("kubernetes: EvictNamespacedPod error code %d: %s", response.StatusCode, kubeResponse.Message)
 	}
+	return
+}
 
-	// Decode the certificate and the key
-	for k, user := range kubeConfig.Users {
-		cert, err := base64.StdEncoding.DecodeString(user.Data.ClientCertificateDataStr)
-		if err != nil {
-			panic(err)
+// Sets status.nominatedNodeName of a pod
+func (api KubernetesCoreV1Api) NominateNamespacedPodNode(namespace, name, nodeName string) (err error) {
+	patch := map[string]interface{}{
+		"status": map[string]string{
+			"nominatedNodeName": nodeName,
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return
+	}
+
+	response, err := api.Request("PATCH", fmt.Sprintf("api/v1/namespaces/%s/pods/%s/status", namespace, name), "application/merge-patch+json", nil, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		kubeResponse := KubeResponse{}
+		json.NewDecoder(response.Body).Decode(&kubeResponse)
+		err = fmt.Errorf("kubernetes: NominateNamespacedPodNode error code %d: %s", response.StatusCode, kubeResponse.Message)
+	}
+	return
+}
+
+// Records an event about a pod, reported by the component (the scheduler name)
+func (api KubernetesCoreV1Api) CreateNamespacedPodEvent(pod KubePod, eventType, reason, message, component string) (err error) {
+	namespace := pod.Metadata.Namespace
+	if namespace == "" {
+		namespace = api.Namespace()
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	event := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata": map[string]string{
+			"generateName": pod.Metadata.Name + ".",
+			"namespace":    namespace,
+		},
+		"involvedObject": map[string]string{
+			"apiVersion":      "v1",
+			"kind":            "Pod",
+			"name":            pod.Metadata.Name,
+			"namespace":       namespace,
+			"uid":             pod.Metadata.UID,
+			"resourceVersion": pod.Metadata.ResourceVersion,
+		},
+		"type":    eventType, // Normal or Warning
+		"reason":  reason,
+		"message": message,
+		"source": map[string]string{
+			"component": component,
+		},
+		"firstTimestamp": now,
+		"lastTimestamp":  now,
+		"count":          1,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	response, err := api.Request("POST", fmt.Sprintf("api/v1/namespaces/%s/events", namespace), "", nil, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 201 {
+		kubeResponse := KubeResponse{}
+		json.NewDecoder(response.Body).Decode(&kubeResponse)
+		err = fmt.Errorf("kubernetes: CreateNamespacedPodEvent error code %d: %s", response.StatusCode, kubeResponse.Message)
+	}
+	return
+}
+
+// Reads the configuration files and loads the config struct
+func (api *KubernetesCoreV1Api) LoadKubeConfig() (err error) {
+	return api.LoadKubeConfigContext("")
+}
+
+// Same as LoadKubeConfig, using the context instead of the current-context when it isn't empty
+func (api *KubernetesCoreV1Api) LoadKubeConfigContext(contextName string) (err error) {
+	var configs []KubeConf
+	for _, path := range getKubeConfigFiles() {
+		kubeConfig, err := readKubeConfigFile(path)
+		if os.IsNotExist(err) { // Like kubectl, the missing files of the list are skipped
+			continue
 		}
-		user.Data.ClientCertificateData = cert
-		key, err := base64.StdEncoding.DecodeString(user.Data.ClientKeyDataStr)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("kubernetes: could not load the configuration %s: %s", path, err)
 		}
-		user.Data.ClientKeyData = key
-		kubeConfig.Users[k] = user
+		configs = append(configs, kubeConfig)
+	}
+	if len(configs) == 0 {
+		return errors.New("kubernetes: could not load the configuration, no kubeconfig file found")
+	}
+
+	kubeConfig := mergeKubeConfigs(configs)
+	if contextName != "" {
+		kubeConfig.CurrentContext = contextName
+	}
+	context, _, _, err := kubeConfig.current()
+	if err != nil {
+		return
 	}
+	if err = kubeConfig.loadCertificates(context.Cluster, context.User); err != nil {
+		return
+	}
+
+	// Besides the client certificate, the user may authenticate with a token or a password
+	context, cluster, user, err := kubeConfig.current()
+	if err != nil {
+		return
+	}
+	api.tokenSource, err = newTokenSource(user, cluster)
+	if err != nil {
+		return
+	}
+	api.username, api.password = user.Username, user.Password
+	api.namespace = context.Namespace
 
 	api.config = kubeConfig
-	api.nodeList = cache.Cache{Timeout: 1 * time.Minute}
 	api.loadTLSInfo()
+	api.nodeInformer = api.NewNodeInformer()
 	return err
 }
 
-func (api KubernetesCoreV1Api) ListNamespacedReplicaset(namespace string, replicaName string) (replicaSet KubeReplicaSet, err error){
-	endpoint := fmt.Sprintf("apis/apps/v1/namespaces/%s/replicasets/%s", namespace, replicaName)
-	response, err := api.Request("GET", endpoint, "", nil, nil)
-	if err != nil {
-		return
+// Informer of the nodes used by ListNodes, it must be run to keep its store up to date
+func (api KubernetesCoreV1Api) Nodes() NodeInformer {
+	return api.nodeInformer
+}
+
+// Default namespace of the current context
+func (api KubernetesCoreV1Api) Namespace() string {
+	if api.namespace == "" {
+		return "default"
 	}
-	defer response.Body.Close()
+	return api.namespace
+}
 
-	err = json.NewDecoder(response.Body).Decode(&replicaSet)
+func (api KubernetesCoreV1Api) ListNamespacedReplicaset(namespace string, replicaName string) (replicaSet KubeReplicaSet, err error){
+	err = api.getNamespacedObject(fmt.Sprintf("apis/apps/v1/namespaces/%s/replicasets/%s", namespace, replicaName), &replicaSet)
 	return
 }
@@ -0,0 +1,56 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+// The match labels and expressions are ANDed
+type KubeLabelSelector struct {
+	MatchLabels      map[string]string              `json:"matchLabels"`
+	MatchExpressions []KubeLabelSelectorRequirement `json:"matchExpressions"`
+}
+
+type KubeLabelSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"` // In, NotIn, Exists or DoesNotExist
+	Values   []string `json:"values"`
+}
+
+// Checks if the labels match the selector. A nil selector matches nothing, an empty one matches everything.
+func (s *KubeLabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return false
+	}
+	for key, value := range s.MatchLabels {
+		if labelValue, ok := labels[key]; !ok || labelValue != value {
+			return false
+		}
+	}
+	for _, requirement := range s.MatchExpressions {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the labels match the requirement
+func (r KubeLabelSelectorRequirement) Matches(labels map[string]string) bool {
+	switch r.Operator {
+	case "In", "NotIn", "Exists", "DoesNotExist":
+		return KubeNodeSelectorRequirement(r).Matches(labels)
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+type LeaderElectionConfig struct {
+	Namespace     string        // Namespace of the lease
+	Name          string        // Name of the lease
+	Identity      string        // Unique identity of this instance
+	LeaseDuration time.Duration // How long the other instances wait before taking over a lease not renewed
+	RenewDeadline time.Duration // How long the leader retries to renew the lease before giving up the leadership
+	RetryPeriod   time.Duration // Wait between the attempts to acquire or renew the lease
+}
+
+// Elects a single leader among the instances sharing a coordination.k8s.io/v1 Lease
+type LeaderElector struct {
+	api    KubernetesCoreV1Api
+	config LeaderElectionConfig
+
+	lease        KubeLease // Last version of the lease seen
+	observedTime time.Time // Local time when the lease was seen changing, the clocks of the instances may differ
+}
+
+func (api KubernetesCoreV1Api) NewLeaderElector(config LeaderElectionConfig) (elector *LeaderElector, err error) {
+	switch {
+	case config.Name == "" || config.Identity == "":
+		err = errors.New("leader election: the lease name and the identity are required")
+	case config.LeaseDuration <= config.RenewDeadline:
+		err = errors.New("leader election: the lease duration must be greater than the renew deadline")
+	case config.RenewDeadline <= config.RetryPeriod:
+		err = errors.New("leader election: the renew deadline must be greater than the retry period")
+	}
+	if err != nil {
+		return
+	}
+	if config.Namespace == "" {
+		config.Namespace = api.Namespace()
+	}
+	return &LeaderElector{api: api, config: config}, nil
+}
+
+// Blocks until the lease is acquired, then calls onStartedLeading and keeps renewing the lease.
+// Returns when the lease can't be renewed before the renew deadline, or when the context is done,
+// releasing the lease so another instance can take over at once.
+// The context passed to onStartedLeading is done when the leadership is lost, the lease is only released
+// once onStartedLeading returns.
+func (le *LeaderElector) Run(ctx context.Context, onStartedLeading func(ctx context.Context)) {
+	if !le.acquire(ctx) {
+		return
+	}
+	log.Printf("leader election: %s acquired the lease %s/%s\n", le.config.Identity, le.config.Namespace, le.config.Name)
+
+	leadingCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		onStartedLeading(leadingCtx)
+	}()
+
+	le.renew(ctx)
+	cancel()
+	if ctx.Err() != nil {
+		<-done // The work in flight must be over before another instance takes over
+		le.release()
+		return
+	}
+	log.Printf("leader election: %s lost the lease %s/%s\n", le.config.Identity, le.config.Namespace, le.config.Name)
+}
+
+// Checks if this instance holds the lease, as of the last attempt
+func (le *LeaderElector) isLeader() bool {
+	return le.lease.Spec.HolderIdentity == le.config.Identity
+}
+
+// Retries until the lease is acquired, returns false if the context is done before
+func (le *LeaderElector) acquire(ctx context.Context) bool {
+	for {
+		if le.tryAcquireOrRenew(ctx) {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(le.config.RetryPeriod):
+		}
+	}
+}
+
+// Renews the lease until a renewal doesn't succeed before the renew deadline, or the context is done
+func (le *LeaderElector) renew(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(le.config.RetryPeriod):
+		}
+
+		deadline := time.Now().Add(le.config.RenewDeadline)
+		for !le.tryAcquireOrRenew(ctx) {
+			if ctx.Err() != nil || time.Now().After(deadline) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(le.config.RetryPeriod):
+			}
+		}
+	}
+}
+
+// Takes the lease if it is free, expired or already held by this instance
+func (le *LeaderElector) tryAcquireOrRenew(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, le.config.RetryPeriod)
+	defer cancel()
+
+	now := time.Now()
+	lease, err := le.api.GetNamespacedLease(ctx, le.config.Namespace, le.config.Name)
+	if err == ErrNotFound {
+		lease = KubeLease{}
+		lease.Metadata.Name = le.config.Name
+		lease.Metadata.Namespace = le.config.Namespace
+		lease.Spec.HolderIdentity = le.config.Identity
+		lease.Spec.LeaseDurationSeconds = int(le.config.LeaseDuration / time.Second)
+		lease.Spec.AcquireTime = KubeMicroTime{now}
+		lease.Spec.RenewTime = KubeMicroTime{now}
+		created, err := le.api.CreateNamespacedLease(ctx, lease)
+		if err != nil {
+			if err != ErrConflict {
+				log.Println("leader election: error while creating the lease:", err)
+			}
+			return false
+		}
+		le.lease, le.observedTime = created, now
+		return true
+	}
+	if err != nil {
+		log.Println("leader election: error while retrieving the lease:", err)
+		return false
+	}
+
+	// The lease expires a lease duration after it was last seen renewed
+	if lease.Spec.HolderIdentity != le.lease.Spec.HolderIdentity || !lease.Spec.RenewTime.Equal(le.lease.Spec.RenewTime.Time) {
+		le.lease, le.observedTime = lease, now
+	}
+	held := lease.Spec.HolderIdentity != "" && lease.Spec.HolderIdentity != le.config.Identity
+	expiry := le.observedTime.Add(time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second)
+	if held && now.Before(expiry) {
+		return false
+	}
+
+	if lease.Spec.HolderIdentity != le.config.Identity {
+		lease.Spec.HolderIdentity = le.config.Identity
+		lease.Spec.AcquireTime = KubeMicroTime{now}
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.LeaseDurationSeconds = int(le.config.LeaseDuration / time.Second)
+	lease.Spec.RenewTime = KubeMicroTime{now}
+
+	// Fails if another instance updated the lease since it was read
+	replaced, err := le.api.ReplaceNamespacedLease(ctx, lease)
+	if err != nil {
+		if err != ErrConflict {
+			log.Println("leader election: error while updating the lease:", err)
+		}
+		return false
+	}
+	le.lease, le.observedTime = replaced, now
+	return true
+}
+
+// Frees the lease held by this instance
+func (le *LeaderElector) release() {
+	if !le.isLeader() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), le.config.RetryPeriod)
+	defer cancel()
+
+	lease := le.lease
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.LeaseDurationSeconds = 1
+	lease.Spec.RenewTime = KubeMicroTime{time.Now()}
+	if _, err := le.api.ReplaceNamespacedLease(ctx, lease); err != nil {
+		log.Println("leader election: error while releasing the lease:", err)
+		return
+	}
+	log.Printf("leader election: %s released the lease %s/%s\n", le.config.Identity, le.config.Namespace, le.config.Name)
+}
@@ -20,8 +20,12 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/user"
+	"path/filepath"
+	"time"
 )
 
 func (api KubernetesCoreV1Api) currentTLSInfo() (clientCert tls.Certificate, serverCaCert *x509.CertPool) {
@@ -51,23 +55,59 @@ func (api *KubernetesCoreV1Api) loadTLSInfo() {
 		}
 	}
 
-	// Get CA Cert data from current cluster
+	// Get CA Cert data and TLS settings from current cluster
 	for _, cluster := range api.config.Clusters {
 		if cluster.Name == currentContextCluster {
 			caCertData = cluster.Data.CertificateAuthorityData
+			api.insecureSkipTLSVerify = cluster.Data.InsecureSkipTLSVerify
+			api.tlsServerName = cluster.Data.TLSServerName
 		}
 	}
 
-	certificate, err := tls.X509KeyPair(certData, keyData)
-	if err != nil {
-		panic(err)
+	// The user may authenticate with a token instead of a client certificate
+	if len(certData) > 0 || len(keyData) > 0 {
+		certificate, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			panic(err)
+		}
+		api.clientCert = certificate
 	}
 
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCertData)
+	// Without CA, the server certificate is verified with the system CAs
+	api.serverCaCert = nil
+	if len(caCertData) > 0 {
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCertData) {
+			log.Println("kubernetes: no valid certificate found in the certificate authority")
+		}
+		api.serverCaCert = caCertPool
+	}
 
-	api.clientCert = certificate
-	api.serverCaCert = caCertPool
+	api.client = api.newHTTPClient()
+}
+
+// Builds the client shared by all the requests, so their connections are kept alive and reused
+func (api KubernetesCoreV1Api) newHTTPClient() *http.Client {
+	certificate, caCertPool := api.currentTLSInfo()
+	tlsConfig := &tls.Config{
+		RootCAs:            caCertPool,
+		InsecureSkipVerify: api.insecureSkipTLSVerify,
+		ServerName:         api.tlsServerName,
+	}
+	if len(certificate.Certificate) > 0 {
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	tlsConfig.BuildNameToCertificate()
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &http.Client{Transport: transport}
 }
 
 func (api KubernetesCoreV1Api) currentApiUrlEndpoint() string {
@@ -84,15 +124,20 @@ func (api KubernetesCoreV1Api) currentApiUrlEndpoint() string {
 	return ""
 }
 
-func getKubeConfigFileDefaultLocation() string {
-	kubeConf, isSet := os.LookupEnv("KUBECONFIG")
-	if isSet && kubeConf != "" {
-		return kubeConf
+// Returns the kubeconfig files of the KUBECONFIG list, ~/.kube/config when it isn't set
+func getKubeConfigFiles() (files []string) {
+	for _, file := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	if len(files) > 0 {
+		return
 	}
 
 	usr, err := user.Current()
 	if err != nil {
 		log.Panic(err)
 	}
-	return usr.HomeDir + "/.kube/config"
+	return []string{usr.HomeDir + "/.kube/config"}
 }
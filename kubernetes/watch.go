@@ -0,0 +1,299 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	watchMinTimeout = 5 * time.Minute // The watches are restarted after a random timeout, to spread them over the API servers
+	watchMinBackoff = 1 * time.Second // Wait before reconnecting after an error, doubled on each error
+	watchMaxBackoff = 30 * time.Second
+)
+
+// The resource version to resume from is too old, the objects must be listed again
+var errGone = errors.New("kubernetes: watch resource version too old")
+
+// Change of an object of a ListWatch, the object is kept raw to be decoded by the caller
+type KubeWatchEvent struct {
+	Type   string          `json:"type"` // ADDED, MODIFIED or DELETED
+	Object json.RawMessage `json:"object"`
+}
+
+// Fields of the objects needed by the watches
+type watchObject struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+}
+
+func (o watchObject) key() string {
+	return objectKey(o.Metadata.Namespace, o.Metadata.Name)
+}
+
+// Objects known by a listWatch, a relist only sends the differences with them as events.
+// They must be updated by the handler of the events.
+type knownObjects interface {
+	// Returns the keys of all the objects
+	keys() []string
+	// Returns the resource version of the object of the key, ok is false when it isn't known
+	resourceVersion(key string) (resourceVersion string, ok bool)
+	// Returns the object of the key as sent in its DELETED event
+	deleted(key string) json.RawMessage
+}
+
+// Last version of the objects of a ListWatch, by key. The channel is consumed by other goroutines,
+// so the objects are kept apart.
+type rawObjects map[string]json.RawMessage
+
+func (o rawObjects) keys() (keys []string) {
+	for key := range o {
+		keys = append(keys, key)
+	}
+	return
+}
+
+func (o rawObjects) resourceVersion(key string) (resourceVersion string, ok bool) {
+	data, ok := o[key]
+	if !ok {
+		return
+	}
+	var object watchObject
+	json.Unmarshal(data, &object)
+	return object.Metadata.ResourceVersion, true
+}
+
+func (o rawObjects) deleted(key string) json.RawMessage {
+	return o[key]
+}
+
+// Keeps the last version of the object of the event
+func (o rawObjects) update(event KubeWatchEvent) {
+	var object watchObject
+	if err := json.Unmarshal(event.Object, &object); err != nil {
+		return
+	}
+	if event.Type == "DELETED" {
+		delete(o, object.key())
+	} else {
+		o[object.key()] = event.Object
+	}
+}
+
+// Lists the objects of the endpoint ("api/v1/pods", "api/v1/nodes"...), then watches their changes from the
+// resource version of the list. The watch is resumed from the last resource version seen when it times out
+// or fails, and the objects are listed again when that version is too old (410 Gone).
+// The changes missed meanwhile are sent as events, so the events describe all the objects at any time:
+// first an ADDED event for each object, then their changes.
+// The channel is closed when the context is done.
+//
+// - values:
+// 		Options of the list and the watch, like a fieldSelector or a labelSelector.
+func (api KubernetesCoreV1Api) ListWatch(ctx context.Context, apiMethod string, values url.Values) <-chan KubeWatchEvent {
+	events := make(chan KubeWatchEvent)
+	go func() {
+		defer close(events)
+		known := rawObjects{}
+		api.listWatch(ctx, apiMethod, values, known, func(event KubeWatchEvent) bool {
+			known.update(event)
+			return sendEvent(ctx, events, event)
+		}, nil)
+	}()
+	return events
+}
+
+// Handles a change of a listWatch, returns false to stop
+type watchHandler func(event KubeWatchEvent) bool
+
+// Loop of ListWatch, the events are handled in the calling goroutine and must keep the known objects up to date.
+// listed, if any, is called each time the events of a list have been handled. Returns when the context is done.
+func (api KubernetesCoreV1Api) listWatch(ctx context.Context, apiMethod string, values url.Values, known knownObjects, handle watchHandler, listed func()) {
+	resourceVersion := ""
+	backoff := watchMinBackoff
+	for ctx.Err() == nil {
+		var err error
+		if resourceVersion == "" {
+			resourceVersion, err = api.relist(ctx, apiMethod, values, known, handle)
+			if err == nil && listed != nil {
+				listed()
+			}
+		}
+		if err == nil {
+			resourceVersion, err = api.watch(ctx, apiMethod, values, resourceVersion, handle)
+		}
+
+		switch {
+		case err == nil: // Timed out, resumed at once
+			backoff = watchMinBackoff
+		case err == errGone:
+			log.Printf("kubernetes: watch of %s expired, listing again\n", apiMethod)
+			resourceVersion = ""
+			backoff = watchMinBackoff
+		case ctx.Err() == nil:
+			log.Printf("kubernetes: watch of %s failed, retrying in %s: %s\n", apiMethod, backoff, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > watchMaxBackoff {
+				backoff = watchMaxBackoff
+			}
+		}
+	}
+}
+
+// Lists the objects and handles the differences with the known ones as events, returns the resource version of the list
+func (api KubernetesCoreV1Api) relist(ctx context.Context, apiMethod string, values url.Values, known knownObjects, handle watchHandler) (resourceVersion string, err error) {
+	response, err := api.RequestWithContext(ctx, "GET", apiMethod, "", values, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		err = fmt.Errorf("kubernetes: list %s error code %d", apiMethod, response.StatusCode)
+		return
+	}
+
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []json.RawMessage `json:"items"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&list); err != nil {
+		return
+	}
+
+	listed := map[string]bool{}
+	for _, item := range list.Items {
+		var object watchObject
+		if err = json.Unmarshal(item, &object); err != nil {
+			return
+		}
+		key := object.key()
+		listed[key] = true
+
+		eventType := "ADDED"
+		if previousVersion, ok := known.resourceVersion(key); ok {
+			if previousVersion == object.Metadata.ResourceVersion {
+				continue
+			}
+			eventType = "MODIFIED"
+		}
+		if !handle(KubeWatchEvent{Type: eventType, Object: item}) {
+			return "", ctx.Err()
+		}
+	}
+
+	// The objects deleted while the watch was down
+	for _, key := range known.keys() {
+		if listed[key] {
+			continue
+		}
+		if !handle(KubeWatchEvent{Type: "DELETED", Object: known.deleted(key)}) {
+			return "", ctx.Err()
+		}
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// Watches the objects from the resource version until the watch times out or fails,
+// returns the last resource version seen to resume from it
+func (api KubernetesCoreV1Api) watch(ctx context.Context, apiMethod string, values url.Values, resourceVersion string, handle watchHandler) (lastResourceVersion string, err error) {
+	lastResourceVersion = resourceVersion
+
+	watchValues := url.Values{}
+	for key, value := range values {
+		watchValues[key] = value
+	}
+	timeout := watchMinTimeout + time.Duration(rand.Int63n(int64(watchMinTimeout)))
+	watchValues.Set("watch", "true")
+	watchValues.Set("resourceVersion", resourceVersion)
+	watchValues.Set("allowWatchBookmarks", "true")
+	watchValues.Set("timeoutSeconds", strconv.Itoa(int(timeout/time.Second)))
+
+	response, err := api.RequestWithContext(ctx, "GET", apiMethod, "", watchValues, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case 200:
+	case 410:
+		return lastResourceVersion, errGone
+	default:
+		return lastResourceVersion, fmt.Errorf("kubernetes: watch %s error code %d", apiMethod, response.StatusCode)
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var event KubeWatchEvent
+		if err = decoder.Decode(&event); err != nil {
+			if err == io.EOF { // The server ended the watch at its timeout
+				err = nil
+			}
+			return
+		}
+
+		if event.Type == "ERROR" {
+			var status KubeResponse
+			json.Unmarshal(event.Object, &status)
+			if status.Code == 410 {
+				return lastResourceVersion, errGone
+			}
+			return lastResourceVersion, fmt.Errorf("kubernetes: watch %s error: %s", apiMethod, status.Message)
+		}
+
+		var object watchObject
+		if err = json.Unmarshal(event.Object, &object); err != nil {
+			return
+		}
+		lastResourceVersion = object.Metadata.ResourceVersion
+
+		if event.Type == "BOOKMARK" { // Only moves the resource version forward
+			continue
+		}
+		if !handle(event) {
+			return lastResourceVersion, ctx.Err()
+		}
+	}
+}
+
+// Sends the event unless the context is done first
+func sendEvent(ctx context.Context, events chan<- KubeWatchEvent, event KubeWatchEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
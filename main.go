@@ -18,17 +18,23 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/draios/kubernetes-scheduler/cache"
 	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+	"github.com/draios/kubernetes-scheduler/prometheus"
 	"github.com/draios/kubernetes-scheduler/sysdig"
 	"os/user"
+	"sync"
 	"time"
 )
 
@@ -37,26 +43,49 @@ var (
 	schedulerName     string
 	kubeAPI           kube.KubernetesCoreV1Api
 	sysdigAPI         sysdig.SysdigApiClient
-	metrics           []map[string]interface{}
-	sysdigMetric      string
-	sysdigMetricLower = true // When comparing the metrics, the lowest will be the best one
-	bestCachedNode    = cache.Cache{Timeout: 15 * time.Second}
+	prometheusAPI     prometheus.PrometheusApiClient
+	metricsProvider   MetricsProvider
+	scoringMetrics    []Metric
+	cachedMetrics     = cache.Cache{Timeout: 15 * time.Second}
 	cachedNodes       = cache.Cache{Timeout: 15 * time.Second}
+	assumedPods       = assumeCache{Timeout: 90 * time.Second} // Metrics window plus the metrics cache
+	schedulingMutex   sync.Mutex                                // One scheduling decision at a time
+	queue             = newSchedulingQueue()
+	gangs             = newGangPermits()
+	leaderElector     *kube.LeaderElector // Only set when several instances run at the same time
+	podInformer       kube.PodInformer    // Pods of the cluster, the nodes are in kubeAPI.Nodes()
 )
 
 // Errors
 var (
-	noDataFound   = errors.New("no data found with those parameters")
 	emptyNodeList = errors.New("node list must contain at least one element")
 	noNodeFound   = errors.New("no node found")
+	errNotSynced  = errors.New("the pods and the nodes aren't listed yet")
 )
 
 // Flags
 var (
 	sysdigTokenFlag    = flag.String("t", "", "Sysdig Cloud Token")
 	kubeConfigFileFlag = flag.String("k", "", "Kubernetes config file")
-	sysdigMetricFlag   = flag.String("m", "", "Sysdig metric to monitorize")
+	kubeContextFlag    = flag.String("context", "", "Kubernetes config context, instead of the current-context")
+	metricsFlag        = flag.String("m", "", "Metrics to monitorize, comma separated")
 	schedulerNameFlag  = flag.String("s", "", "Scheduler name")
+	providerFlag       = flag.String("p", "", "Metrics provider (sysdig, prometheus, metrics-server)")
+	prometheusUrlFlag  = flag.String("u", "", "Prometheus server url")
+	fallbackFlag       = flag.String("f", "", "Fallback strategy when the metrics can't choose a node (retry, random, round-robin, metric:METRICS, pending)")
+	leaseFlag          = flag.String("l", "", "Lease for leader election, as [NAMESPACE/]NAME")
+	leaseDurationFlag  = flag.String("d", "", "Lease duration of the leader election")
+	renewDeadlineFlag  = flag.String("r", "", "Renew deadline of the leader election")
+)
+
+// Timeout for the metrics retrieval of all the nodes
+const metricsTimeout = 10 * time.Second
+
+// Leader election defaults
+const (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	leaseRetryPeriod     = 2 * time.Second
 )
 
 func init() {
@@ -64,47 +93,131 @@ func init() {
 	flag.Usage = usage
 	flag.Parse()
 
-	// SCD_TOKEN parameter / env var
-	if sysdigTokenEnv, tokenSetByEnv := os.LookupEnv("SDC_TOKEN"); !tokenSetByEnv && *sysdigTokenFlag == "" {
-		fmt.Println("Error: Sysdig Cloud token is not set.")
-		usage()
-	} else {
-		if tokenSetByEnv {
-			sysdigAPI.SetToken(sysdigTokenEnv)
+	// SDC_PROVIDER parameter / env var
+	provider := "sysdig"
+	if providerEnv, providerEnvIsSet := os.LookupEnv("SDC_PROVIDER"); providerEnvIsSet {
+		provider = providerEnv
+	}
+	if *providerFlag != "" {
+		provider = *providerFlag
+	}
+
+	switch provider {
+	case "sysdig":
+		// SCD_TOKEN parameter / env var
+		if sysdigTokenEnv, tokenSetByEnv := os.LookupEnv("SDC_TOKEN"); !tokenSetByEnv && *sysdigTokenFlag == "" {
+			fmt.Println("Error: Sysdig Cloud token is not set.")
+			usage()
+		} else {
+			if tokenSetByEnv {
+				sysdigAPI.SetToken(sysdigTokenEnv)
+			}
+			if *sysdigTokenFlag != "" { // If the flag is set, overrides the environment
+				sysdigAPI.SetToken(*sysdigTokenFlag)
+			}
 		}
-		if *sysdigTokenFlag != "" { // If the flag is set, overrides the environment
-			sysdigAPI.SetToken(*sysdigTokenFlag)
+		metricsProvider = sysdigAPI
+	case "prometheus":
+		// PROMETHEUS_URL parameter / env var
+		if prometheusUrlEnv, urlSetByEnv := os.LookupEnv("PROMETHEUS_URL"); !urlSetByEnv && *prometheusUrlFlag == "" {
+			fmt.Println("Error: Prometheus url is not set.")
+			usage()
+		} else {
+			if urlSetByEnv {
+				prometheusAPI.SetUrl(prometheusUrlEnv)
+			}
+			if *prometheusUrlFlag != "" {
+				prometheusAPI.SetUrl(*prometheusUrlFlag)
+			}
 		}
+		metricsProvider = prometheusAPI
+	case "metrics-server":
+		// The kubernetes api is loaded below, keep a reference to it
+		metricsProvider = &kubeAPI
+	default:
+		fmt.Printf("Unknown metrics provider %q\n", provider)
+		usage()
 	}
 
-	// KUBECONFIG parameter / env var
-	if _, kubeTokenSetByEnv := os.LookupEnv("KUBECONFIG"); !kubeTokenSetByEnv && *kubeConfigFileFlag == "" {
-		usr, _ := user.Current()
-		os.Setenv("KUBECONFIG", usr.HomeDir+"/.kube/config")
+	// KUBECONFIG parameter / env var, or the service account when running as a pod
+	_, kubeConfigSetByEnv := os.LookupEnv("KUBECONFIG")
+	if !kubeConfigSetByEnv && *kubeConfigFileFlag == "" && kube.InCluster() {
+		if err := kubeAPI.LoadInClusterConfig(); err != nil {
+			log.Fatalln("fatal: error while loading the in-cluster configuration:", err)
+		}
 	} else {
+		if !kubeConfigSetByEnv && *kubeConfigFileFlag == "" {
+			usr, _ := user.Current()
+			os.Setenv("KUBECONFIG", usr.HomeDir+"/.kube/config")
+		}
 		if *kubeConfigFileFlag != "" {
 			os.Setenv("KUBECONFIG", *kubeConfigFileFlag)
 		}
+		// SDC_CONTEXT parameter / env var
+		kubeContext := os.Getenv("SDC_CONTEXT")
+		if *kubeContextFlag != "" {
+			kubeContext = *kubeContextFlag
+		}
+		if err := kubeAPI.LoadKubeConfigContext(kubeContext); err != nil {
+			log.Fatalln("fatal: error while loading the kubernetes configuration:", err)
+		}
 	}
-	kubeAPI.LoadKubeConfig()
+	podInformer = kubeAPI.NewPodInformer()
 
 	// SCD_METRIC parameter / env var
-	if sysdigMetricEnv, sysdigMetricEnvIsSet := os.LookupEnv("SDC_METRIC"); !sysdigMetricEnvIsSet && *sysdigMetricFlag == "" {
-		fmt.Println("The Sysdig metric must be defined")
+	if metricsEnv, metricsEnvIsSet := os.LookupEnv("SDC_METRIC"); !metricsEnvIsSet && *metricsFlag == "" {
+		fmt.Println("The metric must be defined")
 		usage()
 	} else {
-		if sysdigMetricEnvIsSet {
-			sysdigMetric = sysdigMetricEnv
+		metricsSpec := metricsEnv
+		if *metricsFlag != "" {
+			metricsSpec = *metricsFlag
+		}
+		var err error
+		scoringMetrics, err = parseMetrics(metricsSpec)
+		if err != nil {
+			fmt.Println("Error:", err)
+			usage()
 		}
-		if *sysdigMetricFlag != "" {
-			sysdigMetric = *sysdigMetricFlag
+	}
+
+	// SDC_FALLBACK parameter / env var
+	if fallbackEnv, fallbackEnvIsSet := os.LookupEnv("SDC_FALLBACK"); fallbackEnvIsSet || *fallbackFlag != "" {
+		fallbackSpec := fallbackEnv
+		if *fallbackFlag != "" {
+			fallbackSpec = *fallbackFlag
 		}
-		highOrLowMetric := sysdigMetric[0]
-		if highOrLowMetric == '-' {
-			sysdigMetric = sysdigMetric[1:]
-		} else if highOrLowMetric == '+' {
-			sysdigMetric = sysdigMetric[1:]
-			sysdigMetricLower = false
+		var err error
+		defaultFallback, err = parseFallback(fallbackSpec)
+		if err != nil {
+			fmt.Println("Error:", err)
+			usage()
+		}
+	}
+
+	// SDC_LEASE parameter / env var
+	if leaseEnv, leaseEnvIsSet := os.LookupEnv("SDC_LEASE"); leaseEnvIsSet || *leaseFlag != "" {
+		lease := leaseEnv
+		if *leaseFlag != "" {
+			lease = *leaseFlag
+		}
+		config := kube.LeaderElectionConfig{
+			Name:          lease,
+			LeaseDuration: durationSetting(leaseDurationFlag, "SDC_LEASE_DURATION", defaultLeaseDuration),
+			RenewDeadline: durationSetting(renewDeadlineFlag, "SDC_RENEW_DEADLINE", defaultRenewDeadline),
+			RetryPeriod:   leaseRetryPeriod,
+		}
+		if i := strings.Index(lease, "/"); i != -1 {
+			config.Namespace, config.Name = lease[:i], lease[i+1:]
+		}
+		hostname, _ := os.Hostname()
+		config.Identity = fmt.Sprintf("%s_%d", hostname, time.Now().UnixNano())
+
+		var err error
+		leaderElector, err = kubeAPI.NewLeaderElector(config)
+		if err != nil {
+			fmt.Println("Error:", err)
+			usage()
 		}
 	}
 
@@ -120,23 +233,43 @@ func init() {
 			schedulerName = *schedulerNameFlag
 		}
 	}
+}
 
-	metrics = append(metrics, map[string]interface{}{
-		"id": sysdigMetric,
-		"aggregations": map[string]string{
-			"time": "timeAvg", "group": "avg",
-		},
-	})
+// Returns the duration set by the flag, or else by the env var, or else the default one
+func durationSetting(flagValue *string, env string, defaultValue time.Duration) time.Duration {
+	value, isSet := os.LookupEnv(env)
+	if *flagValue != "" {
+		value, isSet = *flagValue, true
+	}
+	if !isSet {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Error: invalid duration %q\n", value)
+		usage()
+	}
+	return duration
 }
 
 // Usage description
 func usage() {
-	fmt.Printf("Usage: %s [-s SCHEDULER_NAME] [-m [+|-]SYSDIG_METRIC] [-t SYSDIG_TOKEN] [-k KUBERNETES_CONFIG_FILE]", os.Args[0])
+	fmt.Printf("Usage: %s [-s SCHEDULER_NAME] [-p METRICS_PROVIDER] [-m [+|-]METRIC[:WEIGHT],...] [-t SYSDIG_TOKEN] [-u PROMETHEUS_URL] [-f FALLBACK] [-l LEASE [-d LEASE_DURATION] [-r RENEW_DEADLINE]] [-k KUBERNETES_CONFIG_FILE] [--context CONTEXT]", os.Args[0])
 	fmt.Print(`
-If the env KUBECONFIG is not set, the -k option must be provided.
-If the env SDC_TOKEN is not set, the -t option must be provided.
-If the env [+|-]SDC_METRIC is not set, the -m option must be provided. Sort mode: "+" higher, "-" lower. Default sort mode: lower.
+If the env KUBECONFIG is not set, the -k option can be provided. Default: the service account when running as a pod, ~/.kube/config otherwise.
+Several kubeconfig files can be merged, separated by ":". The first file defining a value wins.
+If the env SDC_CONTEXT is not set, the --context option can be provided. Default: the current-context of the kubeconfig.
+If the env SDC_PROVIDER is not set, the -p option can be provided. Default provider: sysdig.
+If the env SDC_TOKEN is not set and the provider is sysdig, the -t option must be provided.
+If the env PROMETHEUS_URL is not set and the provider is prometheus, the -u option must be provided.
+If the env SDC_METRIC is not set, the -m option must be provided, a metric id for sysdig, a PromQL expression for prometheus or a resource for metrics-server.
+Several metrics can be combined with their weights: "-cpu.used.percent:0.6,-memory.used.percent:0.3,+net.bytes.free:0.1".
+Sort mode: "+" higher, "-" lower. Default sort mode: lower. Default weight: 1.
+If the env SDC_FALLBACK is not set, the -f option can be provided. Default fallback: retry.
+The fallback of a pod can be overridden with the annotation scheduling.sysdig.com/fallback.
 If the env SDC_SCHEDULER is not set, the -s option must be provided.
+If the env SDC_LEASE or the -l option is set, only the instance holding the lease ([NAMESPACE/]NAME) schedules pods.
+The lease duration (SDC_LEASE_DURATION / -d, default 15s) and the renew deadline (SDC_RENEW_DEADLINE / -r, default 10s) can be set.
 `)
 	flag.PrintDefaults()
 	os.Exit(2)
@@ -144,61 +277,240 @@ If the env SDC_SCHEDULER is not set, the -s option must be provided.
 
 func main() {
 
-	ch, err := kubeAPI.Watch("GET", "api/v1/pods", nil, nil)
-	if err != nil {
-		log.Fatalln("fatal: error while connecting with the kubernetes Api:", err)
+	podInformer.AddEventHandler(kube.EventHandler{
+		OnAdd:    podChanged,
+		OnUpdate: func(old, new interface{}) { podChanged(new) },
+		OnDelete: podDeleted,
+	})
+	nodes := kubeAPI.Nodes()
+	nodes.AddEventHandler(kube.EventHandler{
+		OnAdd:    func(node interface{}) { queue.MoveAllToActive() }, // The pods may fit in the new node
+		OnUpdate: nodeUpdated,
+	})
+
+	// The informers resume or relist their watches when they fail, no change is missed
+	ctx := context.Background()
+	go nodes.Run(ctx)
+
+	go queue.Run()
+	go gangs.Run()
+	if leaderElector != nil {
+		go runLeaderElection(leaderElector)
+	} else {
+		go runScheduler(context.Background())
 	}
 
-	for data := range ch {
-		go func(data []byte) {
-			event := kube.KubePodEvent{}
-			err := json.Unmarshal(data, &event)
-			if err != nil {
-				log.Println("Error:", err)
-				return
-			}
+	podInformer.Run(ctx)
+}
+
+// Queues a pod when it is pending, has the scheduler name and hasn't been placed yet
+func podChanged(object interface{}) {
+	pod := object.(kube.KubePod)
+	switch {
+	case pod.Spec.NodeName != "":
+		queue.Delete(pod) // Already bound
+	case pod.Status.Phase == "Pending" && pod.Spec.SchedulerName == schedulerName && !assumedPods.isAssumed(pod):
+		queue.Add(pod)
+	}
+}
+
+func podDeleted(object interface{}) {
+	pod := object.(kube.KubePod)
+	queue.Delete(pod)
+	gangs.forget(pod)
+	assumedPods.forget(pod)
+	queue.MoveAllToActive() // Its resources are free now
+}
+
+// Schedules the queued pods one at a time until the context is done, the pod being scheduled is finished first
+func runScheduler(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		queue.Close()
+	}()
 
-			// If the pod has been added, is in Pending phase and has the scheduler name, schedule it.
-			if event.Object.Status.Phase == "Pending" && event.Object.Spec.SchedulerName == schedulerName && event.Type == "ADDED" {
-				log.Println("Scheduling", event.Object.Metadata.Name)
-
-				bestNodeFound, err := getBestNodeByMetrics(nodesAvailable())
-				if err != nil {
-					log.Println("error while retrieving the best node:", err.Error())
-					// In case a node could not be found, fallback to default scheduler
-					log.Println("falling back to the default scheduler...")
-					deploymentName, err := findDeploymentNameFromPod(event.Object)
-					if err != nil {
-						log.Fatalln(err)
-					}
-					deployments, err := kubeAPI.ListNamespacedDeployments(event.Object.Metadata.Namespace, "metadata.name="+deploymentName)
-					if err != nil {
-						log.Fatalln(err)
-					}
-					for _, item := range deployments.Items {
-						_, err := kubeAPI.ReplaceDeploymentScheduler(item, "default-scheduler")
-						if err != nil {
-							log.Fatalf("could not modify deployment %s: %s\n Fatal: those pods won't be re-scheduled, terminating...", item.Metadata.Name, err.Error())
-						}
-					}
-				} else {
-					log.Println("Best node found: ", bestNodeFound.name, bestNodeFound.metric)
-					response, err := scheduler(event.Object.Metadata.Name, bestNodeFound.name, event.Object.Metadata.Namespace)
-					if err != nil {
-						log.Println("error while scheduling a pod:", err)
-					}
-					kubeResponse := kube.KubeResponse{}
-					err = json.NewDecoder(response.Body).Decode(&kubeResponse)
-					if err != nil {
-						log.Println("error while decoding kube response: ", err)
-					}
-					if kubeResponse.Code != 200 && kubeResponse.Code != 201 {
-						log.Println("kube response error: ", kubeResponse.Message)
-					}
-
-					response.Body.Close()
-				}
+	// The cluster snapshots are taken from the informers
+	if !podInformer.WaitForSync(ctx) || !kubeAPI.Nodes().WaitForSync(ctx) {
+		return
+	}
+
+	for {
+		queued, ok := queue.Pop()
+		if !ok || ctx.Err() != nil {
+			return
+		}
+		scheduleOne(queued)
+	}
+}
+
+// Schedules the queued pods only while this instance holds the lease, the other instances keep their queue
+// up to date to take over. The pods in flight can't be handed over, so the process exits when the lease is lost,
+// or once the lease is released on SIGINT / SIGTERM.
+func runLeaderElection(elector *kube.LeaderElector) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	elector.Run(ctx, runScheduler)
+	if ctx.Err() != nil {
+		os.Exit(0)
+	}
+	log.Fatalln("fatal: leader election lost")
+}
+
+// Retries the unschedulable pods when a node changes in a way that could make them fit
+func nodeUpdated(old, new interface{}) {
+	if nodeFingerprint(old.(kube.KubeNode)) != nodeFingerprint(new.(kube.KubeNode)) {
+		queue.MoveAllToActive()
+	}
+}
+
+// Scheduling relevant state of a node
+func nodeFingerprint(kubeNode kube.KubeNode) string {
+	node := newNodeInfo(kubeNode)
+	fingerprint, _ := json.Marshal([]interface{}{node.ready(), kubeNode.Metadata.Labels, kubeNode.Spec.Taints, kubeNode.Status.Allocatable})
+	return string(fingerprint)
+}
+
+// Returns the node nominated for the pod by a preemption when it is available
+func nominatedNode(pod kube.KubePod, nodes []*nodeInfo) *nodeInfo {
+	for _, node := range nodes {
+		if pod.Status.NominatedNodeName != "" && node.node.Metadata.Name == pod.Status.NominatedNodeName {
+			return node
+		}
+	}
+	return nil
+}
+
+// Finds the best node for a queued pod and binds it, the pods that fail are queued again
+func scheduleOne(queued *queuedPod) {
+	pod := queued.pod
+	log.Println("Scheduling", pod.Metadata.Name)
+
+	schedulingMutex.Lock()
+	nodes, cluster := nodesAvailable(pod)
+	if len(nodes) == 0 {
+		schedulingMutex.Unlock()
+		log.Println("no node can run the pod", pod.Metadata.Name)
+		if preemptFor(pod) {
+			queue.AddBackoff(queued)
+			return
+		}
+		// Retried once the victims are gone
+		queue.AddUnschedulable(queued)
+		return
+	}
+
+	var bestNodeFound Node
+	var err error
+	if nominated := nominatedNode(pod, nodes); nominated != nil {
+		// The room was made for this pod, don't let the metrics send it elsewhere
+		bestNodeFound = Node{name: nominated.node.Metadata.Name}
+	} else {
+		bestNodeFound, err = getBestNodeByMetrics(pod, nodes, cluster)
+		if err != nil {
+			log.Println("error while retrieving the best node:", err)
+			bestNodeFound, err = fallbackNode(queued, nodes, cluster)
+		}
+	}
+	if err == nil {
+		// Account the pod in the node until the cluster state and the metrics reflect it
+		assumedPods.assume(pod, bestNodeFound.name)
+	}
+	schedulingMutex.Unlock()
+
+	if err != nil {
+		switch err {
+		case errFallbackPending:
+			workload := queued.podWorkload()
+			log.Printf("leaving the pod %s of %s pending\n", pod.Metadata.Name, workload)
+			message := fmt.Sprintf("the metrics couldn't choose a node for the pod of %s among %d available", workload, len(nodes))
+			if err := kubeAPI.CreateNamespacedPodEvent(pod, "Warning", "FailedScheduling", message, schedulerName); err != nil {
+				log.Println("error while recording the pod event:", err)
 			}
-		}(data)
+			// Retried when the cluster changes or the unschedulable pods are flushed
+			queue.AddUnschedulable(queued)
+		default:
+			log.Printf("no node chosen for the pod %s of %s, retrying later: %s\n", pod.Metadata.Name, queued.podWorkload(), err)
+			queue.AddBackoff(queued)
+		}
+		return
+	}
+
+	log.Println("Best node found: ", bestNodeFound.name, bestNodeFound.score)
+
+	// The members of a pod group wait until enough of them have been placed
+	for _, member := range gangs.permit(queued, bestNodeFound.name, cluster) {
+		bind(member.queued, member.node)
+	}
+}
+
+// Binds a queued pod to a node, the pod is queued again when it fails
+func bind(queued *queuedPod, nodeName string) {
+	pod := queued.pod
+	result, boundNode, err := bindPod(pod, nodeName)
+	switch result {
+	case bindSucceeded:
+		queue.Done(queued)
+	case bindConflict:
+		if boundNode == "" {
+			log.Printf("binding conflict: %s is gone\n", pod.Metadata.Name)
+			assumedPods.forget(pod)
+		} else {
+			// Account the pod where it really is until the cluster state reflects it
+			log.Printf("binding conflict: %s is already bound to %s\n", pod.Metadata.Name, boundNode)
+			assumedPods.assume(pod, boundNode)
+		}
+		queue.Done(queued)
+	default:
+		log.Println("error while scheduling a pod:", err)
+		assumedPods.forget(pod)
+		queue.AddBackoff(queued)
+	}
+}
+
+// Makes room for a pod that fits in no node. The PodDisruptionBudgets are listed before taking the lock,
+// the candidate is chosen under the lock, and the evictions are done after releasing it.
+// Returns true when the pod fits in a node meanwhile.
+func preemptFor(pod kube.KubePod) (fits bool) {
+	if pod.Spec.PreemptionPolicy == "Never" {
+		log.Println("preemption disabled by the pod preemptionPolicy")
+		return
+	}
+	pdbs, err := kubeAPI.ListPodDisruptionBudgets()
+	if err != nil {
+		log.Println("preemption failed:", err)
+		return
+	}
+
+	// The cluster may have changed while the PodDisruptionBudgets were listed
+	schedulingMutex.Lock()
+	nodes, cluster := nodesAvailable(pod)
+	var candidate *preemptionCandidate
+	if len(nodes) == 0 {
+		candidate, err = choosePreemption(pod, cluster, pdbs)
+	}
+	schedulingMutex.Unlock()
+	switch {
+	case len(nodes) > 0:
+		return true
+	case err != nil:
+		log.Println("preemption failed:", err)
+		return
+	case candidate == nil:
+		return // A previous preemption is still making room for the pod
+	}
+
+	nominatedNode, err := preempt(pod, candidate)
+	if err != nil {
+		log.Println("preemption failed:", err)
+	}
+	if nominatedNode != "" {
+		log.Printf("node %s nominated for %s\n", nominatedNode, pod.Metadata.Name)
 	}
+	return
 }
@@ -18,100 +18,124 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"reflect"
-	"strings"
 	"sync"
 	"sort"
+	"strings"
 	"github.com/draios/kubernetes-scheduler/kubernetes"
 )
 
-// Retrieves the metrics information using a name node by calling the Sysdig Api
-func getMetrics(hostname string) (metricValue float64, err error) {
-	hostFilter := fmt.Sprintf(`host.hostName = '%s'`, hostname)
-	start := -60 // TODO make this configurable by params
-	end := 0
-	sampling := 60 // TODO make this configurable by params
+var bestNodeMutex sync.Mutex
 
-	metricDataResponse, err := sysdigAPI.GetData(metrics, start, end, sampling, hostFilter, "host")
-	if err != nil {
-		return
-	} else if metricDataResponse.StatusCode != 200 {
-		err = fmt.Errorf("metric data response: %s", metricDataResponse.Status)
+// Calculates the best node for a pod based in the metrics provided from a list of candidate nodes
+func getBestNodeByMetrics(pod kubernetes.KubePod, nodes []*nodeInfo, cluster *snapshot) (bestNodeFound Node, err error) {
+	bestNodeMutex.Lock()
+	defer bestNodeMutex.Unlock()
+
+	if len(nodes) == 0 {
+		err = emptyNodeList
 		return
 	}
-	defer metricDataResponse.Body.Close()
 
-	all, err := ioutil.ReadAll(metricDataResponse.Body)
-
-	var metricData struct {
-		Data []struct {
-			D []float64 `json:"d"`
-		} `json:"data"`
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.node.Metadata.Name)
 	}
 
-	err = json.Unmarshal(all, &metricData)
+	nodeList, err := getNodesMetrics(names)
 	if err != nil {
 		return
 	}
-
-	if len(metricData.Data) > 0 && len(metricData.Data[0].D) > 0 {
-		metricValue = metricData.Data[0].D[0]
-	} else {
-		err = noDataFound
-	}
-
-	return
+	return rankNodes(pod, nodeList, scoringMetrics, cluster)
 }
 
-var bestNodeMutex sync.Mutex
-
-// Calculates the best node based in the metrics provided form a list of node names
-func getBestNodeByMetrics(nodes []string) (bestNodeFound Node, err error) {
-	bestNodeMutex.Lock()
-	defer bestNodeMutex.Unlock()
-
-	if len(nodes) == 0 {
-		err = emptyNodeList
-		return
+// Scores the nodes by the metrics and returns the best one
+func rankNodes(pod kubernetes.KubePod, nodeList NodeList, metrics []Metric, cluster *snapshot) (bestNodeFound Node, err error) {
+	// The metrics don't reflect yet the pods in flight to the nodes
+	scoreNodes(nodeList, metrics)
+	for i := range nodeList {
+		if node, ok := cluster.nodesByName[nodeList[i].name]; ok {
+			nodeList[i].score -= node.inFlightLoad()
+		}
 	}
+	return bestNodeFromList(pod, nodeList, cluster)
+}
 
-	// If the best node was cached, return it
+// Retrieves the scoring metrics of a list of node names, the nodes whose metrics couldn't be retrieved are left out
+func getNodesMetrics(nodes []string) (nodeList NodeList, err error) {
+	// If the metrics of the same nodes were cached, return them
 	if cachedNodes, ok := cachedNodes.Data(); ok {
 		if reflect.DeepEqual(cachedNodes, nodes) {
-			if bestNode, ok := bestCachedNode.Data(); ok {
+			if cachedList, ok := cachedMetrics.Data(); ok {
 				log.Println("Using cache...")
-				return bestNode.(Node), nil
+				return append(NodeList{}, cachedList.(NodeList)...), nil
 			}
 		}
 	}
 
+	nodeList, err = fetchNodesMetrics(nodes, scoringMetrics)
+	if err != nil {
+		return
+	}
+
+	// Cache the result
+	cachedNodes.SetData(nodes)
+	cachedMetrics.SetData(append(NodeList{}, nodeList...))
+	return
+}
+
+// Retrieves the metrics of a list of node names from the metrics provider
+func fetchNodesMetrics(nodes []string, metrics []Metric) (nodeList NodeList, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsTimeout)
+	defer cancel()
+
 	// We will make all the request asynchronous for performance reasons
 	wg := sync.WaitGroup{}
 	nodeStatsChannel := make(chan Node, len(nodes))
 	nodeStatsErrorsChannel := make(chan Node, len(nodes))
 
+	// Retrieve the metrics of all the nodes at once when the provider supports it
+	batchValues := map[string]map[string]float64{}
+	if batchProvider, ok := metricsProvider.(BatchMetricsProvider); ok {
+		for _, metric := range metrics {
+			values, err := batchProvider.NodesMetric(ctx, nodes, metric.query)
+			if err != nil {
+				log.Printf("batch request of %s failed, falling back to per node requests: %s\n", metric.query, err)
+				continue
+			}
+			batchValues[metric.query] = values
+		}
+	}
+
 	// Launch all requests asynchronously
-	// to retrieve the metrics of each node
+	// to retrieve the metrics of each node not found in the batch
 	for _, node := range nodes {
 		wg.Add(1)
 
 		go func(nodeName string) {
 			defer wg.Done()
 
-			split := strings.Split(nodeName, ".")
-			nodeNameLittle := split[0]
-
-			metricsValue, err := getMetrics(nodeNameLittle)
-			if err == nil { // No error found, we will send the struct
-				nodeStatsChannel <- Node{name: nodeName, metric: metricsValue}
-			} else {
-				nodeStatsErrorsChannel <- Node{name: nodeName, err: err}
+			node := Node{name: nodeName, metrics: map[string]float64{}}
+			for _, metric := range metrics {
+				if metricsValue, ok := batchValues[metric.query][nodeName]; ok {
+					node.metrics[metric.query] = metricsValue
+					continue
+				}
+
+				metricsValue, err := metricsProvider.NodeMetric(ctx, nodeName, metric.query)
+				if err != nil { // A node can only be scored with all its metrics
+					node.err = fmt.Errorf("%s: %s", metric.query, err)
+					nodeStatsErrorsChannel <- node
+					return
+				}
+				node.metrics[metric.query] = metricsValue
 			}
+			nodeStatsChannel <- node
 		}(node)
 	}
 
@@ -120,19 +144,10 @@ func getBestNodeByMetrics(nodes []string) (bestNodeFound Node, err error) {
 	close(nodeStatsErrorsChannel)
 
 	// Fill the list with all the succeeded nodes
-	nodeList := NodeList{}
+	nodeList = NodeList{}
 	for node := range nodeStatsChannel {
 		nodeList = append(nodeList, node)
 	}
-	if len(nodeList) == 0 {
-		err = noNodeFound
-	}
-
-	// Calculate the best node
-	bestNodeFound, err = bestNodeFromList(nodeList)
-	if err != nil {
-		return
-	}
 
 	// Print any errors found
 	errorHappenedString := `Error retrieving node "%s": "%s" \n`
@@ -140,16 +155,15 @@ func getBestNodeByMetrics(nodes []string) (bestNodeFound Node, err error) {
 		log.Printf(errorHappenedString, node.name, node.err.Error())
 	}
 
-	// No errors found? Cache the result
-	if err == nil {
-		bestCachedNode.SetData(bestNodeFound)
+	if len(nodeList) == 0 {
+		err = noNodeFound
 	}
-
 	return
 }
 
-// Sorts the list and returns the best node
-func bestNodeFromList(list NodeList) (node Node, err error) {
+// Adds the priorities of the pod to the metrics score, sorts the list and returns the best node
+func bestNodeFromList(pod kubernetes.KubePod, list NodeList, cluster *snapshot) (node Node, err error) {
+	addPriorityScores(pod, list, cluster)
 	sort.Sort(list)
 
 	length := len(list)
@@ -157,52 +171,124 @@ func bestNodeFromList(list NodeList) (node Node, err error) {
 		return node, emptyNodeList
 	}
 
-	if sysdigMetricLower {
-		return list[0], nil // Get the first -> Lower
-	} else {
-		return list[length-1], nil // Get the last -> Higher
-	}
+	return list[length-1], nil // Get the last -> Highest score
 }
 
-// Returns a list of all the available nodes found in the Kubernetes cluster
-func nodesAvailable() (readyNodes []string) {
-	if nodes, ok := cachedNodes.Data(); ok {
-		return nodes.([]string)
-	}
-
-	nodes, err := kubeAPI.ListNodes()
+// Returns the ready nodes found in the Kubernetes cluster where the pod fits, and the cluster state used to find them
+func nodesAvailable(pod kubernetes.KubePod) (availableNodes []*nodeInfo, cluster *snapshot) {
+	cluster, err := clusterSnapshot()
 	if err != nil {
 		log.Println(err)
 	}
-	for _, node := range nodes {
-		for _, status := range node.Status.Conditions {
-			if status.Status == "True" && status.Type == "Ready" {
-				readyNodes = append(readyNodes, node.Metadata.Name)
-			}
+
+	readyNodes := 0
+	discarded := map[string]int{} // Number of nodes discarded by reason
+	for _, node := range cluster.nodes {
+		if !node.ready() {
+			continue
+		}
+		readyNodes++
+
+		if err := podFitsNode(pod, node, cluster); err != nil {
+			discarded[err.Error()]++
+			continue
 		}
+		availableNodes = append(availableNodes, node)
 	}
 
-	cachedNodes.SetData(readyNodes)
+	if len(discarded) > 0 {
+		log.Printf("%d/%d nodes are available for %s: %v\n", len(availableNodes), readyNodes, pod.Metadata.Name, discarded)
+	}
 	return
 }
 
-func findDeploymentNameFromPod(pod kubernetes.KubePod) (deploymentName string, err error) {
-	if pod.Metadata.OwnerReferences[0].Kind == "ReplicaSet" {
-		replicaSet, err := kubeAPI.ListNamespacedReplicaset(pod.Metadata.Namespace, pod.Metadata.OwnerReferences[0].Name)
-		if err != nil {
-			return "", err
+// Returns the nodes of the cluster with the pods currently bound to each one of them, from the informers
+func clusterSnapshot() (cluster *snapshot, err error) {
+	cluster = newSnapshot()
+	nodes := kubeAPI.Nodes()
+	if !nodes.HasSynced() || !podInformer.HasSynced() {
+		return cluster, errNotSynced
+	}
+	for _, kubeNode := range nodes.List() {
+		cluster.addNode(newNodeInfo(kubeNode))
+	}
+
+	bound := map[string]bool{}
+	for _, node := range cluster.nodes {
+		for _, pod := range podInformer.ByIndex(kubernetes.IndexNodeName, node.node.Metadata.Name) {
+			// Finished pods don't use resources anymore
+			if pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed" {
+				continue
+			}
+			node.addPod(pod)
+			bound[pod.Metadata.UID] = true
+		}
+	}
+
+	// The pods placed by the scheduler may not be listed as bound yet
+	for _, pod := range assumedPods.list() {
+		node, ok := cluster.nodesByName[pod.Spec.NodeName]
+		if !ok {
+			continue
 		}
-		if replicaSet.Metadata.OwnerReferences[0].Kind == "Deployment" {
-			return replicaSet.Metadata.OwnerReferences[0].Name, nil
+		node.assumedPods = append(node.assumedPods, pod)
+		if !bound[pod.Metadata.UID] {
+			node.addPod(pod)
 		}
 	}
-	return "", fmt.Errorf("%s is not supported yet as a OwnerReference", pod.Metadata.OwnerReferences[0].Kind)
+	return
+}
+
+// Outcome of a pod binding
+type bindResult int
+
+const (
+	bindSucceeded bindResult = iota // The pod is bound to the node
+	bindFailed                      // The pod isn't bound, it can be retried
+	bindConflict                    // The pod was bound by someone else, or deleted
+)
+
+// Binds a pod to a node. On conflict, boundNode is the node where someone else bound the pod first,
+// empty when the pod is gone. A conflict with an earlier binding to the same node is a success.
+func bindPod(pod kubernetes.KubePod, nodeName string) (result bindResult, boundNode string, err error) {
+	response, err := scheduler(pod.Metadata.Name, nodeName, pod.Metadata.Namespace)
+	if err != nil {
+		return bindFailed, "", err
+	}
+	defer response.Body.Close()
+
+	kubeResponse := kubernetes.KubeResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&kubeResponse); err != nil {
+		log.Println("error while decoding kube response: ", err)
+	}
+	switch {
+	case response.StatusCode == 200 || response.StatusCode == 201:
+		return bindSucceeded, nodeName, nil
+	case response.StatusCode != 409 && !strings.Contains(kubeResponse.Message, "already assigned"):
+		return bindFailed, "", fmt.Errorf("binding error code %d: %s", response.StatusCode, kubeResponse.Message)
+	}
+
+	// Find out where the pod is
+	current, err := kubeAPI.GetNamespacedPod(pod.Metadata.Namespace, pod.Metadata.Name)
+	switch {
+	case err == kubernetes.ErrNotFound:
+		return bindConflict, "", nil
+	case err != nil:
+		return bindFailed, "", fmt.Errorf("binding conflict, error while retrieving the pod: %s", err)
+	case current.Metadata.UID != pod.Metadata.UID:
+		return bindConflict, "", nil // Replaced by a pod with the same name
+	case current.Spec.NodeName == nodeName:
+		return bindSucceeded, nodeName, nil
+	case current.Spec.NodeName == "":
+		return bindFailed, "", fmt.Errorf("binding conflict: %s", kubeResponse.Message)
+	}
+	return bindConflict, current.Spec.NodeName, nil
 }
 
 // Binds a pod with a node in a namespace
 func scheduler(podName, nodeName, namespace string) (response *http.Response, err error) {
 	if namespace == "" {
-		namespace = "default"
+		namespace = kubeAPI.Namespace()
 	}
 
 	body := map[string]interface{}{
@@ -0,0 +1,159 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+// Checks the required pod affinity and anti-affinity of the pod, and the required anti-affinity
+// of the pods already running that would reject it
+func podMatchesInterPodAffinity(pod kube.KubePod, node *nodeInfo, cluster *snapshot) error {
+	labels := node.node.Metadata.Labels
+
+	for i, term := range pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		value, ok := labels[term.TopologyKey]
+		if !ok {
+			return fmt.Errorf("pod affinity mismatch")
+		}
+		counts := cluster.matchingPodsByTopology(pod, term, fmt.Sprint("podAffinity/", i))
+		if counts[value] > 0 {
+			continue
+		}
+		// The first pod of a group matching its own affinity would never be placed otherwise
+		if len(counts) == 0 && term.MatchesPod(pod, pod) {
+			continue
+		}
+		return fmt.Errorf("pod affinity mismatch")
+	}
+
+	for i, term := range pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		value, ok := labels[term.TopologyKey]
+		if !ok {
+			continue
+		}
+		counts := cluster.matchingPodsByTopology(pod, term, fmt.Sprint("podAntiAffinity/", i))
+		if counts[value] > 0 {
+			return fmt.Errorf("pod anti-affinity conflict")
+		}
+	}
+
+	for topologyKey, values := range cluster.existingAntiAffinity(pod) {
+		if value, ok := labels[topologyKey]; ok && values[value] {
+			return fmt.Errorf("existing pod anti-affinity conflict")
+		}
+	}
+	return nil
+}
+
+// Adds the weights of the preferred pod affinity terms and subtracts the ones of the preferred
+// anti-affinity terms, once for every matching pod in the topology domain of the node
+func interPodAffinityScore(pod kube.KubePod, node *nodeInfo, cluster *snapshot) float64 {
+	labels := node.node.Metadata.Labels
+	score := 0
+
+	for i, weighted := range pod.Spec.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if value, ok := labels[weighted.PodAffinityTerm.TopologyKey]; ok {
+			counts := cluster.matchingPodsByTopology(pod, weighted.PodAffinityTerm, fmt.Sprint("preferredPodAffinity/", i))
+			score += weighted.Weight * counts[value]
+		}
+	}
+
+	for i, weighted := range pod.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if value, ok := labels[weighted.PodAffinityTerm.TopologyKey]; ok {
+			counts := cluster.matchingPodsByTopology(pod, weighted.PodAffinityTerm, fmt.Sprint("preferredPodAntiAffinity/", i))
+			score -= weighted.Weight * counts[value]
+		}
+	}
+	return float64(score)
+}
+
+// Counts the pods selected by a term of the pod by topology value (the value of the term topologyKey in
+// the node labels). The counts are computed once per pod and snapshot, the key identifies the term in the pod.
+func (s *snapshot) matchingPodsByTopology(pod kube.KubePod, term kube.KubePodAffinityTerm, key string) map[string]int {
+	return s.memoize(pod, "matchingPodsByTopology/"+key, func() interface{} {
+		counts := map[string]int{}
+		for _, candidate := range s.termCandidates(pod, term) {
+			value, ok := candidate.node.node.Metadata.Labels[term.TopologyKey]
+			if ok && term.MatchesPod(pod, candidate.pod) {
+				counts[value]++
+			}
+		}
+		return counts
+	}).(map[string]int)
+}
+
+// Returns the pods a term of the owner may select: the ones with the least common label of its matchLabels,
+// or the ones of its namespaces when its selector has no matchLabels
+func (s *snapshot) termCandidates(owner kube.KubePod, term kube.KubePodAffinityTerm) (candidates []placedPod) {
+	if term.LabelSelector == nil || len(term.LabelSelector.MatchLabels) == 0 {
+		namespaces := term.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{owner.Metadata.Namespace}
+		}
+		for _, namespace := range namespaces {
+			candidates = append(candidates, s.podsInNamespace(namespace)...)
+		}
+		return
+	}
+	first := true
+	for key, value := range term.LabelSelector.MatchLabels {
+		pods := s.podsWithLabel(key, value)
+		if first || len(pods) < len(candidates) {
+			candidates, first = pods, false
+		}
+	}
+	return
+}
+
+// Returns the topology values forbidden to the pod by the required anti-affinity of the pods
+// already running, indexed by topology key
+func (s *snapshot) existingAntiAffinity(pod kube.KubePod) map[string]map[string]bool {
+	return s.memoize(pod, "existingAntiAffinity", func() interface{} {
+		forbidden := map[string]map[string]bool{}
+		for _, existing := range s.podsWithAntiAffinity() {
+			for _, term := range existing.pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				value, ok := existing.node.node.Metadata.Labels[term.TopologyKey]
+				if !ok || !term.MatchesPod(existing.pod, pod) {
+					continue
+				}
+				if forbidden[term.TopologyKey] == nil {
+					forbidden[term.TopologyKey] = map[string]bool{}
+				}
+				forbidden[term.TopologyKey][value] = true
+			}
+		}
+		return forbidden
+	}).(map[string]map[string]bool)
+}
+
+// Returns the pods of the snapshot with a required anti-affinity, found once per snapshot
+func (s *snapshot) podsWithAntiAffinity() []placedPod {
+	if pods, ok := s.memo["podsWithAntiAffinity"]; ok {
+		return pods.([]placedPod)
+	}
+	pods := []placedPod{}
+	for _, existing := range s.allPods() {
+		if len(existing.pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) > 0 {
+			pods = append(pods, existing)
+		}
+	}
+	s.memo["podsWithAntiAffinity"] = pods
+	return pods
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+// A predicate checks if a pod can be placed in a node, returning the reason when it can't
+type predicate func(pod kube.KubePod, node *nodeInfo, cluster *snapshot) error
+
+// Predicates that must pass before a node is scored
+var predicates = []predicate{
+	podMatchesNodeSelector,
+	podToleratesNodeTaints,
+	podFitsResources,
+	podMatchesInterPodAffinity,
+	podMatchesTopologySpread,
+}
+
+// Resources checked against the node allocatable, besides the pod count
+var fitResources = []string{"cpu", "memory", "ephemeral-storage"}
+
+// Runs all the predicates, returns the first failure
+func podFitsNode(pod kube.KubePod, node *nodeInfo, cluster *snapshot) error {
+	for _, p := range predicates {
+		if err := p(pod, node, cluster); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the node has room for the pod requests and for one more pod
+func podFitsResources(pod kube.KubePod, node *nodeInfo, cluster *snapshot) error {
+	if maxPods, ok := node.allocatable["pods"]; ok && float64(len(node.pods)+1) > maxPods {
+		return fmt.Errorf("too many pods")
+	}
+
+	requests := podRequests(pod)
+	for _, resource := range fitResources {
+		request := requests[resource]
+		if request == 0 {
+			continue
+		}
+		if node.requested[resource]+request > node.allocatable[resource] {
+			return fmt.Errorf("insufficient %s", resource)
+		}
+	}
+	return nil
+}
+
+// Checks the pod tolerates all the NoSchedule and NoExecute taints of the node
+func podToleratesNodeTaints(pod kube.KubePod, node *nodeInfo, cluster *snapshot) error {
+	for _, taint := range node.node.Spec.Taints {
+		if taint.Effect != "NoSchedule" && taint.Effect != "NoExecute" {
+			continue
+		}
+		if !toleratesTaint(pod.Spec.Tolerations, taint) {
+			return fmt.Errorf("untolerated taint %s:%s", taint.Key, taint.Effect)
+		}
+	}
+	return nil
+}
+
+func toleratesTaint(tolerations []kube.KubeToleration, taint kube.KubeTaint) bool {
+	for _, toleration := range tolerations {
+		if toleration.ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the node labels match the pod nodeSelector and required node affinity
+func podMatchesNodeSelector(pod kube.KubePod, node *nodeInfo, cluster *snapshot) error {
+	for key, value := range pod.Spec.NodeSelector {
+		if nodeValue, ok := node.node.Metadata.Labels[key]; !ok || nodeValue != value {
+			return fmt.Errorf("node selector mismatch")
+		}
+	}
+
+	required := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required != nil && !required.Matches(node.node) {
+		return fmt.Errorf("node affinity mismatch")
+	}
+	return nil
+}
+
+// Returns the resources requested by a pod: the sum of its containers requests,
+// or the highest init container request when it is bigger, as they run one by one before the containers.
+func podRequests(pod kube.KubePod) map[string]float64 {
+	requests := map[string]float64{}
+	for _, container := range pod.Spec.Containers {
+		for resource, value := range containerRequests(container) {
+			requests[resource] += value
+		}
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for resource, value := range containerRequests(container) {
+			requests[resource] = math.Max(requests[resource], value)
+		}
+	}
+	return requests
+}
+
+// Returns the requests of a container, when only the limit is set it is used as the request
+func containerRequests(container kube.KubeContainer) map[string]float64 {
+	requests := map[string]float64{}
+	for resource, quantity := range container.Resources.Limits {
+		if value, err := kube.ParseQuantity(quantity); err == nil {
+			requests[resource] = value
+		}
+	}
+	for resource, quantity := range container.Resources.Requests {
+		if value, err := kube.ParseQuantity(quantity); err == nil {
+			requests[resource] = value
+		}
+	}
+	return requests
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+var noPreemptionCandidate = errors.New("no node can make room for the pod by evicting lower priority pods")
+
+// A node where the pod would fit once the victims are evicted
+type preemptionCandidate struct {
+	node    *nodeInfo
+	victims []kube.KubePod
+}
+
+// Chooses the node where evicting a minimal set of lower priority pods makes room for a pod that doesn't fit
+// in any node, without violating any PodDisruptionBudget. It only reads the cluster snapshot, the evictions
+// are done by preempt. A nil candidate with no error means a previous preemption is still making room for the pod.
+func choosePreemption(pod kube.KubePod, cluster *snapshot, pdbs []kube.KubePodDisruptionBudget) (best *preemptionCandidate, err error) {
+	// A previous preemption is still making room for the pod
+	if node, ok := cluster.nodesByName[pod.Status.NominatedNodeName]; ok {
+		for _, existing := range node.pods {
+			if existing.Metadata.DeletionTimestamp != nil && existing.Spec.Priority < pod.Spec.Priority {
+				return nil, nil
+			}
+		}
+	}
+
+	for _, node := range cluster.nodes {
+		if !node.ready() {
+			continue
+		}
+		candidate, ok := selectVictims(pod, node, cluster, pdbs)
+		if ok && (best == nil || betterPreemptionCandidate(candidate, best)) {
+			best = candidate
+		}
+	}
+	if best == nil {
+		return nil, noPreemptionCandidate
+	}
+	return
+}
+
+// Nominates the node of the candidate for the pod, then evicts the victims. The pod must be scheduled again
+// once the victims are gone. The node stays nominated when some evictions fail, so the room already freed
+// is kept for the pod.
+func preempt(pod kube.KubePod, candidate *preemptionCandidate) (nominatedNode string, err error) {
+	node := candidate.node.node.Metadata.Name
+	if err = kubeAPI.NominateNamespacedPodNode(pod.Metadata.Namespace, pod.Metadata.Name, node); err != nil {
+		return
+	}
+	nominatedNode = node
+
+	for _, victim := range candidate.victims {
+		log.Printf("preempting %s/%s from %s for %s\n", victim.Metadata.Namespace, victim.Metadata.Name, nominatedNode, pod.Metadata.Name)
+		if evictErr := kubeAPI.EvictNamespacedPod(victim.Metadata.Namespace, victim.Metadata.Name); evictErr != nil {
+			log.Printf("error while evicting %s/%s: %s\n", victim.Metadata.Namespace, victim.Metadata.Name, evictErr)
+			if err == nil {
+				err = evictErr
+			}
+		}
+	}
+	return
+}
+
+// Finds the minimal set of lower priority pods to evict from the node so the pod fits in it.
+// All the lower priority pods are removed, then they are added back one by one, the most important first,
+// as long as the pod still fits. The pods protected by a PodDisruptionBudget are added back first, the node
+// isn't a candidate when one of them still has to be evicted.
+// The pods placed by the scheduler but not bound yet, like the members of a waiting pod group, aren't evicted.
+// The inter-pod predicates keep seeing the victims, only the room they free is taken into account.
+func selectVictims(pod kube.KubePod, node *nodeInfo, cluster *snapshot, pdbs []kube.KubePodDisruptionBudget) (candidate *preemptionCandidate, ok bool) {
+	assumed := map[string]bool{}
+	for _, assumedPod := range node.assumedPods {
+		assumed[podKey(assumedPod)] = true
+	}
+
+	reduced := newNodeInfo(node.node)
+	potentialVictims := []kube.KubePod{}
+	for _, existing := range node.pods {
+		evictable := existing.Spec.NodeName != "" && !assumed[podKey(existing)] && existing.Metadata.DeletionTimestamp == nil
+		if evictable && existing.Spec.Priority < pod.Spec.Priority {
+			potentialVictims = append(potentialVictims, existing)
+		} else {
+			reduced.addPod(existing)
+		}
+	}
+	if len(potentialVictims) == 0 || podFitsNode(pod, reduced, cluster) != nil {
+		return nil, false
+	}
+
+	sort.SliceStable(potentialVictims, func(i, j int) bool {
+		return potentialVictims[i].Spec.Priority > potentialVictims[j].Spec.Priority
+	})
+	disruptionsAllowed := map[int]int{}
+	for i, pdb := range pdbs {
+		disruptionsAllowed[i] = pdb.Status.DisruptionsAllowed
+	}
+	violating, nonViolating := []kube.KubePod{}, []kube.KubePod{}
+	for _, victim := range potentialVictims {
+		violates := false
+		for i, pdb := range pdbs {
+			if pdb.MatchesPod(victim) {
+				disruptionsAllowed[i]--
+				if disruptionsAllowed[i] < 0 {
+					violates = true
+				}
+			}
+		}
+		if violates {
+			violating = append(violating, victim)
+		} else {
+			nonViolating = append(nonViolating, victim)
+		}
+	}
+
+	candidate = &preemptionCandidate{node: node}
+	reprieve := func(victim kube.KubePod) bool {
+		reduced.addPod(victim)
+		if podFitsNode(pod, reduced, cluster) == nil {
+			return true
+		}
+		reduced.removeLastPod()
+		candidate.victims = append(candidate.victims, victim)
+		return false
+	}
+	for _, victim := range violating {
+		if !reprieve(victim) {
+			return nil, false
+		}
+	}
+	for _, victim := range nonViolating {
+		reprieve(victim)
+	}
+	return candidate, true
+}
+
+// Prefers the candidates evicting less important pods, then the ones evicting less pods
+func betterPreemptionCandidate(a, b *preemptionCandidate) bool {
+	if highestPriority(a.victims) != highestPriority(b.victims) {
+		return highestPriority(a.victims) < highestPriority(b.victims)
+	}
+	return len(a.victims) < len(b.victims)
+}
+
+func highestPriority(pods []kube.KubePod) int {
+	highest := 0
+	for i, pod := range pods {
+		if i == 0 || pod.Spec.Priority > highest {
+			highest = pod.Spec.Priority
+		}
+	}
+	return highest
+}
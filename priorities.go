@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"math"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+// A priority rates a node for a pod, the higher the better
+type priority struct {
+	weight float64 // Share of the priority in the node score, the metrics weight 1 altogether
+	score  func(pod kube.KubePod, node *nodeInfo, cluster *snapshot) float64
+}
+
+// Priorities added to the metrics score
+var priorities = []priority{
+	{weight: 1, score: preferNoScheduleScore},
+	{weight: 1, score: preferredNodeAffinityScore},
+	{weight: 1, score: interPodAffinityScore},
+	{weight: 1, score: topologySpreadScore},
+}
+
+// Adds the weighted priorities to the score of the nodes.
+// Like the metrics, each priority is min-max normalized across the list.
+func addPriorityScores(pod kube.KubePod, list NodeList, cluster *snapshot) {
+	for _, p := range priorities {
+		scores := make([]float64, len(list))
+		min, max := math.Inf(1), math.Inf(-1)
+		for i, node := range list {
+			if info, ok := cluster.nodesByName[node.name]; ok {
+				scores[i] = p.score(pod, info, cluster)
+			}
+			min = math.Min(min, scores[i])
+			max = math.Max(max, scores[i])
+		}
+
+		if max <= min { // All the nodes are equally good
+			continue
+		}
+		for i := range list {
+			list[i].score += p.weight * (scores[i] - min) / (max - min)
+		}
+	}
+}
+
+// Penalizes the nodes with PreferNoSchedule taints the pod doesn't tolerate
+func preferNoScheduleScore(pod kube.KubePod, node *nodeInfo, cluster *snapshot) float64 {
+	untolerated := 0
+	for _, taint := range node.node.Spec.Taints {
+		if taint.Effect == "PreferNoSchedule" && !toleratesTaint(pod.Spec.Tolerations, taint) {
+			untolerated++
+		}
+	}
+	return -float64(untolerated)
+}
+
+// Sums the weights of the preferred node affinity terms matched by the node
+func preferredNodeAffinityScore(pod kube.KubePod, node *nodeInfo, cluster *snapshot) float64 {
+	score := 0
+	for _, term := range pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if term.Preference.Matches(node.node) {
+			score += term.Weight
+		}
+	}
+	return float64(score)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Small api wrapper to evaluate PromQL expressions against a Prometheus server
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Returned when the expression doesn't return any sample
+var ErrNoDataFound = errors.New("prometheus: no data found with those parameters")
+
+type PrometheusApiClient struct {
+	url string
+}
+
+// Sets the Prometheus server base url, for example "http://prometheus.monitoring:9090"
+func (api *PrometheusApiClient) SetUrl(url string) {
+	api.url = strings.TrimSuffix(url, "/")
+}
+
+// Response of the /api/v1/query endpoint
+type QueryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// A single series of an instant vector
+type Sample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+// Values used to render the node query template
+type nodeQuery struct {
+	Node     string // Kubernetes node name
+	Hostname string // Short host name, "node-1.example.com" -> "node-1"
+}
+
+// Evaluates a PromQL expression for a node and returns its value.
+//
+// - node:
+// 		The Kubernetes node name.
+//
+// - query:
+// 		A PromQL expression used as a text/template, "{{.Node}}" is replaced by the node name and
+// 		"{{.Hostname}}" by the short host name. For example: node_load1{instance=~"{{.Node}}.*"}.
+// 		The expression must return a scalar or a vector with a single series.
+func (api PrometheusApiClient) NodeMetric(ctx context.Context, node, query string) (metricValue float64, err error) {
+	tmpl, err := template.New("query").Parse(query)
+	if err != nil {
+		return
+	}
+	expression := bytes.Buffer{}
+	err = tmpl.Execute(&expression, nodeQuery{Node: node, Hostname: strings.Split(node, ".")[0]})
+	if err != nil {
+		return
+	}
+
+	samples, err := api.Query(ctx, expression.String())
+	if err != nil {
+		return
+	}
+
+	switch len(samples) {
+	case 0:
+		err = ErrNoDataFound
+	case 1:
+		metricValue, err = samples[0].Float()
+	default:
+		err = fmt.Errorf("prometheus: expression %q returned %d series, aggregate it to a single one", expression.String(), len(samples))
+	}
+	return
+}
+
+// Evaluates an instant query and returns the resulting samples, a scalar result is returned as a single sample
+func (api PrometheusApiClient) Query(ctx context.Context, query string) (samples []Sample, err error) {
+	values := url.Values{}
+	values.Add("query", query)
+
+	response, err := api.Request(ctx, "GET", "api/v1/query", values)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	var queryResponse QueryResponse
+	err = json.NewDecoder(response.Body).Decode(&queryResponse)
+	if err != nil {
+		err = fmt.Errorf("prometheus: query response %s: %s", response.Status, err)
+		return
+	}
+	if queryResponse.Status != "success" {
+		err = fmt.Errorf("prometheus: query error %s: %s", queryResponse.ErrorType, queryResponse.Error)
+		return
+	}
+
+	switch queryResponse.Data.ResultType {
+	case "vector":
+		err = json.Unmarshal(queryResponse.Data.Result, &samples)
+	case "scalar":
+		sample := Sample{}
+		err = json.Unmarshal(queryResponse.Data.Result, &sample.Value)
+		samples = append(samples, sample)
+	default:
+		err = fmt.Errorf("prometheus: unsupported result type %q", queryResponse.Data.ResultType)
+	}
+	return
+}
+
+// Returns the value of the sample, Prometheus encodes it as [ <unix_time>, "<value>" ]
+func (s Sample) Float() (value float64, err error) {
+	if len(s.Value) != 2 {
+		return 0, fmt.Errorf("prometheus: malformed sample value %v", s.Value)
+	}
+	str, ok := s.Value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("prometheus: malformed sample value %v", s.Value)
+	}
+	return strconv.ParseFloat(str, 64)
+}
+
+// Makes a request to the Prometheus HTTP API.
+//
+// - httpMethod:
+// 		The HTTP request method ("GET", "POST", ...).
+//
+// - apiMethod:
+// 		The API endpoint ("api/v1/query", "api/v1/series", ...).
+//
+// - values:
+// 		Query string parameters.
+func (api PrometheusApiClient) Request(ctx context.Context, httpMethod, apiMethod string, values url.Values) (response *http.Response, err error) {
+	if api.url == "" {
+		err = errors.New("prometheus: the server url is not set")
+		return
+	}
+
+	client := http.Client{Timeout: 5 * time.Second}
+	request, err := http.NewRequest(httpMethod, api.url+"/"+apiMethod, nil)
+	if err != nil {
+		return
+	}
+	request = request.WithContext(ctx)
+	if values != nil {
+		request.URL.RawQuery = values.Encode()
+	}
+	request.Header.Add("Accept", "application/json")
+
+	response, err = client.Do(request)
+	return
+}
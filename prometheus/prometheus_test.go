@@ -0,0 +1,163 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Starts a Prometheus stand-in answering the queries with a canned response, the received queries are recorded
+func newTestServer(t *testing.T, status int, body string) (api PrometheusApiClient, queries *[]string) {
+	queries = &[]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		*queries = append(*queries, r.URL.Query().Get("query"))
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	api.SetUrl(server.URL + "/")
+	return
+}
+
+func TestNodeMetricTemplating(t *testing.T) {
+	api, queries := newTestServer(t, 200, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1530000000,"0.5"]}]}}`)
+
+	_, err := api.NodeMetric(context.Background(), "node-1.example.com", `node_load1{instance=~"{{.Node}}.*",host="{{.Hostname}}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `node_load1{instance=~"node-1.example.com.*",host="node-1"}`
+	if len(*queries) != 1 || (*queries)[0] != expected {
+		t.Errorf("queries %q, expected %q", *queries, expected)
+	}
+}
+
+func TestNodeMetricInvalidTemplate(t *testing.T) {
+	api, queries := newTestServer(t, 200, `{}`)
+
+	if _, err := api.NodeMetric(context.Background(), "node-1", `node_load1{instance="{{.Node"}`); err == nil {
+		t.Error("expected a template error")
+	}
+	if len(*queries) != 0 {
+		t.Errorf("no query expected, got %q", *queries)
+	}
+}
+
+func TestNodeMetricResults(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		value float64
+		err   string // Part of the expected error, empty when no error is expected
+	}{
+		{
+			name:  "vector",
+			body:  `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"instance":"node-1"},"value":[1530000000,"42.5"]}]}}`,
+			value: 42.5,
+		},
+		{
+			name:  "scalar",
+			body:  `{"status":"success","data":{"resultType":"scalar","result":[1530000000,"3"]}}`,
+			value: 3,
+		},
+		{
+			name: "empty vector",
+			body: `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			err:  ErrNoDataFound.Error(),
+		},
+		{
+			name: "several series",
+			body: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1530000000,"1"]},{"metric":{},"value":[1530000000,"2"]}]}}`,
+			err:  "returned 2 series",
+		},
+		{
+			name: "unsupported result type",
+			body: `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			err:  `unsupported result type "matrix"`,
+		},
+		{
+			name: "malformed value",
+			body: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1530000000,"NaN?"]}]}}`,
+			err:  "invalid syntax",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api, _ := newTestServer(t, 200, test.body)
+
+			value, err := api.NodeMetric(context.Background(), "node-1", `node_load1{instance="{{.Node}}"}`)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("error %v, expected %q", err, test.err)
+			case test.err == "" && value != test.value:
+				t.Errorf("value %v, expected %v", value, test.value)
+			}
+		})
+	}
+}
+
+func TestQueryErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{
+			name:   "query error",
+			status: 400,
+			body:   `{"status":"error","errorType":"bad_data","error":"parse error at char 5"}`,
+			err:    "query error bad_data: parse error at char 5",
+		},
+		{
+			name:   "unavailable",
+			status: 503,
+			body:   "Service Unavailable",
+			err:    "503 Service Unavailable",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api, _ := newTestServer(t, test.status, test.body)
+
+			_, err := api.Query(context.Background(), "up")
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, expected %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestRequestWithoutUrl(t *testing.T) {
+	api := PrometheusApiClient{}
+	if _, err := api.Query(context.Background(), "up"); err == nil {
+		t.Error("expected an error without server url")
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"container/heap"
+	"log"
+	"sync"
+	"time"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+const (
+	podInitialBackoff         = 1 * time.Second
+	podMaxBackoff             = 10 * time.Second
+	unschedulableFlushTimeout = 60 * time.Second // Unschedulable pods are retried at least this often
+	queueFlushPeriod          = 1 * time.Second
+)
+
+// A pod waiting to be scheduled
+type queuedPod struct {
+	pod          kube.KubePod
+	attempts     int                // Failed scheduling attempts
+	backoffUntil time.Time          // The pod can't be retried before
+	timestamp    time.Time          // Last time the pod was added to a queue
+	workload     *kube.KubeWorkload // Resolved on first use by podWorkload
+}
+
+// Returns the workload of the queued pod. It takes a request by controller, so it is resolved once
+// and kept while the pod is queued.
+func (q *queuedPod) podWorkload() kube.KubeWorkload {
+	if q.workload == nil {
+		workload, err := kubeAPI.ResolvePodWorkload(q.pod)
+		if err != nil {
+			log.Println("error while resolving the pod workload:", err)
+		}
+		q.workload = &workload
+	}
+	return *q.workload
+}
+
+// Pods waiting to be scheduled:
+//
+// - active:
+// 		Pods ready to be scheduled, ordered by priority and then by creation time.
+//
+// - backoff:
+// 		Pods that failed to be scheduled, moved to active once their exponential backoff expires.
+//
+// - unschedulable:
+// 		Pods that didn't fit in any node, moved to active when the cluster changes or after a while.
+type schedulingQueue struct {
+	active        activeQueue
+	backoff       map[string]*queuedPod
+	unschedulable map[string]*queuedPod
+	inFlight      map[string]*queuedPod // Pods popped and being scheduled
+	closed        bool
+	mutex         sync.Mutex
+	cond          *sync.Cond
+}
+
+func newSchedulingQueue() *schedulingQueue {
+	q := &schedulingQueue{
+		backoff:       map[string]*queuedPod{},
+		unschedulable: map[string]*queuedPod{},
+		inFlight:      map[string]*queuedPod{},
+	}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+// Adds a new pod to the active queue, or updates it when it is already queued
+func (q *schedulingQueue) Add(pod kube.KubePod) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	key := podKey(pod)
+	if queued, ok := q.inFlight[key]; ok {
+		queued.pod = pod
+		return
+	}
+	if queued, ok := q.backoff[key]; ok {
+		queued.pod = pod
+		return
+	}
+	if queued, ok := q.unschedulable[key]; ok {
+		// The pod changed, it may fit now
+		delete(q.unschedulable, key)
+		queued.pod = pod
+		q.pushActive(queued)
+		return
+	}
+	if i := q.active.index(key); i != -1 {
+		q.active[i].pod = pod
+		heap.Fix(&q.active, i)
+		return
+	}
+	q.pushActive(&queuedPod{pod: pod})
+}
+
+// Removes a pod from all the queues, the pod is gone or it was scheduled by someone else
+func (q *schedulingQueue) Delete(pod kube.KubePod) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	key := podKey(pod)
+	delete(q.inFlight, key)
+	delete(q.backoff, key)
+	delete(q.unschedulable, key)
+	if i := q.active.index(key); i != -1 {
+		heap.Remove(&q.active, i)
+	}
+}
+
+// Waits for an active pod and returns it, ok is false when the queue is closed
+func (q *schedulingQueue) Pop() (queued *queuedPod, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for len(q.active) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+	queued = heap.Pop(&q.active).(*queuedPod)
+	q.inFlight[podKey(queued.pod)] = queued
+	return queued, true
+}
+
+// The pod popped has been scheduled
+func (q *schedulingQueue) Done(queued *queuedPod) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.inFlight, podKey(queued.pod))
+}
+
+// The pod popped failed to be scheduled, it will be retried after an exponential backoff
+func (q *schedulingQueue) AddBackoff(queued *queuedPod) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	key := podKey(queued.pod)
+	if _, ok := q.inFlight[key]; !ok { // Deleted meanwhile
+		return
+	}
+	delete(q.inFlight, key)
+
+	queued.attempts++
+	backoff := podInitialBackoff
+	for i := 1; i < queued.attempts && backoff < podMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > podMaxBackoff {
+		backoff = podMaxBackoff
+	}
+	queued.backoffUntil = time.Now().Add(backoff)
+	queued.timestamp = time.Now()
+	q.backoff[key] = queued
+}
+
+// The pod popped didn't fit in any node, it will be retried when the cluster changes
+func (q *schedulingQueue) AddUnschedulable(queued *queuedPod) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	key := podKey(queued.pod)
+	if _, ok := q.inFlight[key]; !ok { // Deleted meanwhile
+		return
+	}
+	delete(q.inFlight, key)
+
+	queued.attempts++
+	queued.timestamp = time.Now()
+	q.unschedulable[key] = queued
+}
+
+// Retries the unschedulable pods, a node or a pod changed and they may fit now.
+// The pods still in backoff will be moved once it expires.
+func (q *schedulingQueue) MoveAllToActive() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	for key, queued := range q.unschedulable {
+		delete(q.unschedulable, key)
+		if queued.backoffUntil.After(now) {
+			q.backoff[key] = queued
+		} else {
+			q.pushActive(queued)
+		}
+	}
+}
+
+// Moves the pods whose backoff expired, and the unschedulable pods waiting for too long, to the active queue
+func (q *schedulingQueue) flush() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	for key, queued := range q.backoff {
+		if !queued.backoffUntil.After(now) {
+			delete(q.backoff, key)
+			q.pushActive(queued)
+		}
+	}
+	for key, queued := range q.unschedulable {
+		if now.Sub(queued.timestamp) > unschedulableFlushTimeout {
+			delete(q.unschedulable, key)
+			q.pushActive(queued)
+		}
+	}
+}
+
+// Flushes the queue periodically until it is closed
+func (q *schedulingQueue) Run() {
+	ticker := time.NewTicker(queueFlushPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		q.mutex.Lock()
+		closed := q.closed
+		q.mutex.Unlock()
+		if closed {
+			return
+		}
+		q.flush()
+	}
+}
+
+// Wakes up the Pop waiters, no pod will be returned anymore
+func (q *schedulingQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *schedulingQueue) pushActive(queued *queuedPod) {
+	queued.timestamp = time.Now()
+	heap.Push(&q.active, queued)
+	q.cond.Signal()
+}
+
+// Heap of pods, the highest priority first and then the oldest
+type activeQueue []*queuedPod
+
+func (a activeQueue) Len() int {
+	return len(a)
+}
+
+func (a activeQueue) Less(i, j int) bool {
+	if a[i].pod.Spec.Priority != a[j].pod.Spec.Priority {
+		return a[i].pod.Spec.Priority > a[j].pod.Spec.Priority
+	}
+	return a[i].pod.Metadata.CreationTimestamp.Before(a[j].pod.Metadata.CreationTimestamp)
+}
+
+func (a activeQueue) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a *activeQueue) Push(x interface{}) {
+	*a = append(*a, x.(*queuedPod))
+}
+
+func (a *activeQueue) Pop() interface{} {
+	old := *a
+	n := len(old)
+	item := old[n-1]
+	*a = old[:n-1]
+	return item
+}
+
+func (a activeQueue) index(key string) int {
+	for i, queued := range a {
+		if podKey(queued.pod) == key {
+			return i
+		}
+	}
+	return -1
+}
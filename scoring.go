@@ -0,0 +1,127 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Parses a list of weighted metrics: "[+|-]METRIC[:WEIGHT],[+|-]METRIC[:WEIGHT],...".
+// Sort mode: "+" higher, "-" lower. Default sort mode: lower. Default weight: 1.
+// The weights are normalized so they sum 1.
+func parseMetrics(spec string) (metrics []Metric, err error) {
+	totalWeight := 0.0
+	for _, item := range splitMetrics(spec) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		metric := Metric{weight: 1, lower: true}
+		switch item[0] {
+		case '-':
+			item = item[1:]
+		case '+':
+			item = item[1:]
+			metric.lower = false
+		}
+
+		// The weight is optional and PromQL expressions may contain colons, only a trailing number is a weight
+		if i := strings.LastIndex(item, ":"); i != -1 {
+			if weight, err := strconv.ParseFloat(item[i+1:], 64); err == nil {
+				metric.weight = weight
+				item = item[:i]
+			}
+		}
+		if metric.weight < 0 || math.IsNaN(metric.weight) || math.IsInf(metric.weight, 0) {
+			return nil, fmt.Errorf("invalid weight for metric %q", item)
+		}
+
+		metric.query = item
+		if metric.query == "" {
+			return nil, fmt.Errorf("empty metric in %q", spec)
+		}
+		totalWeight += metric.weight
+		metrics = append(metrics, metric)
+	}
+
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no metric found in %q", spec)
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("the sum of the metric weights must be greater than 0")
+	}
+	for i := range metrics {
+		metrics[i].weight /= totalWeight
+	}
+	return
+}
+
+// Splits the metric list by commas, ignoring the ones inside brackets or quotes of an expression
+func splitMetrics(spec string) (items []string) {
+	depth := 0
+	var quote rune
+	start := 0
+	for i, c := range spec {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' || c == '{' || c == '[':
+			depth++
+		case c == ')' || c == '}' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, spec[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, spec[start:])
+}
+
+// Sets the score of the nodes, the weighted sum of their metrics min-max normalized across the list.
+// A normalized metric goes from 0 (worst node) to 1 (best node).
+func scoreNodes(list NodeList, metrics []Metric) {
+	for i := range list {
+		list[i].score = 0
+	}
+
+	for _, metric := range metrics {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, node := range list {
+			min = math.Min(min, node.metrics[metric.query])
+			max = math.Max(max, node.metrics[metric.query])
+		}
+
+		for i, node := range list {
+			normalized := 1.0 // All the nodes are equally good
+			if max > min {
+				normalized = (node.metrics[metric.query] - min) / (max - min)
+				if metric.lower {
+					normalized = 1 - normalized
+				}
+			}
+			list[i].score += metric.weight * normalized
+		}
+	}
+}
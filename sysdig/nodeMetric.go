@@ -0,0 +1,147 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysdig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Returned when Sysdig Monitor answers without any sample for the query
+var ErrNoDataFound = errors.New("sysdig: no data found with those parameters")
+
+const (
+	metricWindow   = -60 // Last minute of data
+	metricSampling = 60  // A single sample for the whole window
+)
+
+// Retrieves the average value of a metric for a node during the last minute.
+//
+// - node:
+// 		The Kubernetes node name, only the short host name is used to filter ("node-1.example.com" -> "node-1").
+//
+// - metric:
+// 		A Sysdig Monitor metric id, for example "cpu.used.percent".
+func (api SysdigApiClient) NodeMetric(ctx context.Context, node, metric string) (metricValue float64, err error) {
+	hostname := strings.Split(node, ".")[0]
+	hostFilter := fmt.Sprintf(`host.hostName = '%s'`, hostname)
+
+	metrics := []map[string]interface{}{metricAggregation(metric)}
+
+	response, err := api.GetDataWithContext(ctx, metrics, metricWindow, 0, metricSampling, hostFilter, "host")
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		err = fmt.Errorf("sysdig: metric data response: %s", response.Status)
+		return
+	}
+
+	var metricData struct {
+		Data []struct {
+			D []float64 `json:"d"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&metricData)
+	if err != nil {
+		return
+	}
+
+	if len(metricData.Data) > 0 && len(metricData.Data[0].D) > 0 {
+		metricValue = metricData.Data[0].D[0]
+	} else {
+		err = ErrNoDataFound
+	}
+	return
+}
+
+// Retrieves the average value of a metric during the last minute for several nodes with a single request,
+// segmenting the data by host name. Nodes without data are missing from the returned map.
+func (api SysdigApiClient) NodesMetric(ctx context.Context, nodes []string, metric string) (metricValues map[string]float64, err error) {
+	// Several nodes could share the same short host name
+	nodesByHostname := map[string][]string{}
+	hostnames := []string{}
+	for _, node := range nodes {
+		hostname := strings.Split(node, ".")[0]
+		if _, ok := nodesByHostname[hostname]; !ok {
+			hostnames = append(hostnames, fmt.Sprintf("'%s'", hostname))
+		}
+		nodesByHostname[hostname] = append(nodesByHostname[hostname], node)
+	}
+	hostFilter := fmt.Sprintf("host.hostName in (%s)", strings.Join(hostnames, ", "))
+
+	metrics := []map[string]interface{}{
+		{"id": "host.hostName"},
+		metricAggregation(metric),
+	}
+	paging := map[string]int{"from": 0, "to": len(hostnames) - 1}
+
+	response, err := api.getData(ctx, metrics, metricWindow, 0, metricSampling, hostFilter, "host", paging)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		err = fmt.Errorf("sysdig: metric data response: %s", response.Status)
+		return
+	}
+
+	// Each row is [ hostname, value ]
+	var metricData struct {
+		Data []struct {
+			D []interface{} `json:"d"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&metricData)
+	if err != nil {
+		return
+	}
+
+	metricValues = map[string]float64{}
+	for _, row := range metricData.Data {
+		if len(row.D) < 2 {
+			continue
+		}
+		hostname, okHostname := row.D[0].(string)
+		value, okValue := row.D[1].(float64)
+		if !okHostname || !okValue {
+			continue
+		}
+		for _, node := range nodesByHostname[hostname] {
+			metricValues[node] = value
+		}
+	}
+
+	if len(metricValues) == 0 {
+		err = ErrNoDataFound
+	}
+	return
+}
+
+// Metric definition averaged across time and hosts
+func metricAggregation(metric string) map[string]interface{} {
+	return map[string]interface{}{
+		"id": metric,
+		"aggregations": map[string]string{
+			"time": "timeAvg", "group": "avg",
+		},
+	}
+}
@@ -18,6 +18,7 @@ limitations under the License.
 package sysdig
 
 import (
+	"context"
 	"net/http"
 	"fmt"
 	"encoding/json"
@@ -76,6 +77,16 @@ func (api *SysdigApiClient) SetToken(token string) {
 // 		datasourceType can be explicitly set to avoid any ambiguity and allow the user to select precisely what kind of
 // 		data should be used for the request.
 func (api SysdigApiClient) GetData(metrics []map[string]interface{}, start, end, sampling int, filter, dataSourceType string) (response *http.Response, err error) {
+	return api.GetDataWithContext(context.Background(), metrics, start, end, sampling, filter, dataSourceType)
+}
+
+// Same as GetData, the request is aborted when the context is done
+func (api SysdigApiClient) GetDataWithContext(ctx context.Context, metrics []map[string]interface{}, start, end, sampling int, filter, dataSourceType string) (response *http.Response, err error) {
+	return api.getData(ctx, metrics, start, end, sampling, filter, dataSourceType, nil)
+}
+
+// Builds and sends the data request, paging limits the rows returned by a segmented query
+func (api SysdigApiClient) getData(ctx context.Context, metrics []map[string]interface{}, start, end, sampling int, filter, dataSourceType string, paging map[string]int) (response *http.Response, err error) {
 	if dataSourceType == "" {
 		dataSourceType = "host"
 	}
@@ -103,10 +114,14 @@ func (api SysdigApiClient) GetData(metrics []map[string]interface{}, start, end,
 		reqBody["sampling"] = sampling
 	}
 
+	if paging != nil {
+		reqBody["paging"] = paging
+	}
+
 	reqBytes, err := json.Marshal(reqBody)
 	body := bytes.NewReader(reqBytes)
 
-	return api.Request("POST", "api/data", body)
+	return api.RequestWithContext(ctx, "POST", "api/data", body)
 }
 
 // Makes a request to the Sysdig API endpoint.
@@ -120,6 +135,11 @@ func (api SysdigApiClient) GetData(metrics []map[string]interface{}, start, end,
 // - body:
 // 		Information that will be sent to the endpoint.
 func (api SysdigApiClient) Request(httpMethod, apiMethod string, body io.Reader) (response *http.Response, err error) {
+	return api.RequestWithContext(context.Background(), httpMethod, apiMethod, body)
+}
+
+// Same as Request, the request is aborted when the context is done
+func (api SysdigApiClient) RequestWithContext(ctx context.Context, httpMethod, apiMethod string, body io.Reader) (response *http.Response, err error) {
 
 	// Create the request
 	client := http.Client{Timeout: 5 * time.Second}
@@ -127,6 +147,7 @@ func (api SysdigApiClient) Request(httpMethod, apiMethod string, body io.Reader)
 	if err != nil {
 		return
 	}
+	request = request.WithContext(ctx)
 	// Header needed to connect with Sysdig Cloud
 	request.Header.Add("Authorization", "Bearer "+api.token)
 	// Get the info in json
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+// Matching pods of a spread constraint by topology domain
+type spreadCounts struct {
+	counts map[string]int // Matching pods by value of the topology key
+	min    int            // Lowest count among all the domains
+	total  int
+}
+
+// Checks that placing the pod in the node keeps the skew of the DoNotSchedule constraints under their maxSkew
+func podMatchesTopologySpread(pod kube.KubePod, node *nodeInfo, cluster *snapshot) error {
+	for i, constraint := range pod.Spec.TopologySpreadConstraints {
+		if constraint.WhenUnsatisfiable != "DoNotSchedule" {
+			continue
+		}
+		value, ok := node.node.Metadata.Labels[constraint.TopologyKey]
+		if !ok {
+			return fmt.Errorf("missing topology key %s", constraint.TopologyKey)
+		}
+
+		spread := cluster.spreadCounts(pod, constraint, i)
+		selfMatch := 0
+		if constraint.LabelSelector.Matches(pod.Metadata.Labels) {
+			selfMatch = 1
+		}
+		if spread.counts[value]+selfMatch-spread.min > constraint.MaxSkew {
+			return fmt.Errorf("topology spread constraint %s exceeded", constraint.TopologyKey)
+		}
+	}
+	return nil
+}
+
+// Prefers the domains with less matching pods for the ScheduleAnyway constraints,
+// the nodes without the topology key are the least preferred
+func topologySpreadScore(pod kube.KubePod, node *nodeInfo, cluster *snapshot) float64 {
+	score := 0
+	for i, constraint := range pod.Spec.TopologySpreadConstraints {
+		if constraint.WhenUnsatisfiable != "ScheduleAnyway" {
+			continue
+		}
+		spread := cluster.spreadCounts(pod, constraint, i)
+		if value, ok := node.node.Metadata.Labels[constraint.TopologyKey]; ok {
+			score -= spread.counts[value]
+		} else {
+			score -= spread.total + 1
+		}
+	}
+	return float64(score)
+}
+
+// Counts the pods of the namespace matching the constraint selector by topology domain. Only the ready
+// nodes matching the pod node selection and having the topology key make up the domains.
+// The counts are computed once per pod and snapshot, index identifies the constraint in the pod.
+func (s *snapshot) spreadCounts(pod kube.KubePod, constraint kube.KubeTopologySpreadConstraint, index int) spreadCounts {
+	return s.memoize(pod, fmt.Sprint("spreadCounts/", index), func() interface{} {
+		spread := spreadCounts{counts: map[string]int{}}
+		domains := map[*nodeInfo]string{} // Topology value of the nodes making up the domains
+		for _, node := range s.nodes {
+			value, ok := node.node.Metadata.Labels[constraint.TopologyKey]
+			if !ok || !node.ready() || podMatchesNodeSelector(pod, node, s) != nil {
+				continue
+			}
+			domains[node] = value
+			if _, ok := spread.counts[value]; !ok {
+				spread.counts[value] = 0 // Empty domains count too
+			}
+		}
+		for _, existing := range s.podsInNamespace(pod.Metadata.Namespace) {
+			value, ok := domains[existing.node]
+			if ok && constraint.LabelSelector.Matches(existing.pod.Metadata.Labels) {
+				spread.counts[value]++
+				spread.total++
+			}
+		}
+
+		first := true
+		for _, count := range spread.counts {
+			if first || count < spread.min {
+				spread.min = count
+				first = false
+			}
+		}
+		return spread
+	}).(spreadCounts)
+}
@@ -16,10 +16,36 @@ limitations under the License.
 
 package main
 
+import (
+	"context"
+
+	kube "github.com/draios/kubernetes-scheduler/kubernetes"
+)
+
+// MetricsProvider abstracts the monitoring backend used to score the nodes
+type MetricsProvider interface {
+	// Returns the current value of the query (a metric id, an expression...) for the node
+	NodeMetric(ctx context.Context, node, query string) (float64, error)
+}
+
+// BatchMetricsProvider is implemented by the backends able to retrieve the metric of several nodes in a single request
+type BatchMetricsProvider interface {
+	// Returns the value of the query by node name, nodes without data are not present in the map
+	NodesMetric(ctx context.Context, nodes []string, query string) (map[string]float64, error)
+}
+
+// A metric used to score the nodes
+type Metric struct {
+	query  string
+	weight float64 // Share of the metric in the node score, all the weights sum 1
+	lower  bool    // When comparing the metric, the lowest will be the best one
+}
+
 type Node struct {
-	name   string
-	metric float64
-	err    error
+	name    string
+	metrics map[string]float64 // Metric values by query
+	score   float64            // Weighted score of the normalized metrics, the higher the better
+	err     error
 }
 
 type NodeList []Node
@@ -29,9 +55,146 @@ func (n NodeList) Len() int {
 }
 
 func (n NodeList) Less(i, j int) bool {
-	return n[i].metric < n[j].metric
+	return n[i].score < n[j].score
 }
 
 func (n NodeList) Swap(i, j int) {
 	n[i], n[j] = n[j], n[i]
 }
+
+// State of the cluster used to schedule a pod, it is taken again for every scheduling attempt
+type snapshot struct {
+	nodes       []*nodeInfo
+	nodesByName map[string]*nodeInfo
+	memo        map[string]interface{} // Computations shared by the predicates and priorities, see memoize
+}
+
+// A pod of the snapshot and the node where it runs
+type placedPod struct {
+	pod  kube.KubePod
+	node *nodeInfo
+}
+
+func newSnapshot() *snapshot {
+	return &snapshot{
+		nodesByName: map[string]*nodeInfo{},
+		memo:        map[string]interface{}{},
+	}
+}
+
+func (s *snapshot) addNode(node *nodeInfo) {
+	s.nodes = append(s.nodes, node)
+	s.nodesByName[node.node.Metadata.Name] = node
+}
+
+// Returns the value computed for the pod under the key, computing it on first use. The values are
+// memoized per pod, so the snapshot can be used to schedule several pods.
+func (s *snapshot) memoize(pod kube.KubePod, key string, compute func() interface{}) interface{} {
+	key = pod.Metadata.Namespace + "/" + pod.Metadata.Name + "/" + pod.Metadata.UID + "/" + key
+	if value, ok := s.memo[key]; ok {
+		return value
+	}
+	value := compute()
+	s.memo[key] = value
+	return value
+}
+
+// Returns the pods of the snapshot with the label, found with the label index of the pod informer
+func (s *snapshot) podsWithLabel(key, value string) []placedPod {
+	return s.placePods(podInformer.ByIndex(kube.IndexLabels, key+"="+value), func(pod kube.KubePod) bool {
+		labelValue, ok := pod.Metadata.Labels[key]
+		return ok && labelValue == value
+	})
+}
+
+// Returns the pods of the snapshot in the namespace, found with the namespace index of the pod informer
+func (s *snapshot) podsInNamespace(namespace string) []placedPod {
+	return s.placePods(podInformer.ByIndex(kube.IndexNamespace, namespace), func(pod kube.KubePod) bool {
+		return pod.Metadata.Namespace == namespace
+	})
+}
+
+// Finds the nodes of the pods of the informer, skipping the ones the snapshot doesn't account (finished,
+// or not bound to a node of the snapshot). The pods placed by the scheduler and not listed as bound yet
+// are taken from their nodes when they match.
+func (s *snapshot) placePods(pods []kube.KubePod, matches func(pod kube.KubePod) bool) (placed []placedPod) {
+	found := map[string]bool{}
+	for _, pod := range pods {
+		node, ok := s.nodesByName[pod.Spec.NodeName]
+		if !ok || pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed" {
+			continue
+		}
+		placed = append(placed, placedPod{pod: pod, node: node})
+		found[pod.Metadata.UID] = true
+	}
+	for _, node := range s.nodes {
+		for _, pod := range node.assumedPods {
+			if !found[pod.Metadata.UID] && matches(pod) {
+				placed = append(placed, placedPod{pod: pod, node: node})
+				found[pod.Metadata.UID] = true
+			}
+		}
+	}
+	return
+}
+
+// Returns all the pods of the snapshot
+func (s *snapshot) allPods() (pods []placedPod) {
+	for _, node := range s.nodes {
+		for _, pod := range node.pods {
+			pods = append(pods, placedPod{pod: pod, node: node})
+		}
+	}
+	return
+}
+
+// A node and the pods already bound to it
+type nodeInfo struct {
+	node        kube.KubeNode
+	pods        []kube.KubePod
+	assumedPods []kube.KubePod     // Pods recently placed in the node by the scheduler
+	allocatable map[string]float64 // Allocatable quantities by resource name
+	requested   map[string]float64 // Sum of the requests of the pods by resource name
+}
+
+func newNodeInfo(node kube.KubeNode) *nodeInfo {
+	info := &nodeInfo{
+		node:        node,
+		allocatable: map[string]float64{},
+		requested:   map[string]float64{},
+	}
+	for resource, quantity := range node.Status.Allocatable {
+		value, err := kube.ParseQuantity(quantity)
+		if err != nil {
+			continue
+		}
+		info.allocatable[resource] = value
+	}
+	return info
+}
+
+// Accounts a pod as running in the node
+func (n *nodeInfo) addPod(pod kube.KubePod) {
+	n.pods = append(n.pods, pod)
+	for resource, value := range podRequests(pod) {
+		n.requested[resource] += value
+	}
+}
+
+// Undoes the last addPod
+func (n *nodeInfo) removeLastPod() {
+	last := n.pods[len(n.pods)-1]
+	n.pods = n.pods[:len(n.pods)-1]
+	for resource, value := range podRequests(last) {
+		n.requested[resource] -= value
+	}
+}
+
+func (n *nodeInfo) ready() bool {
+	for _, status := range n.node.Status.Conditions {
+		if status.Status == "True" && status.Type == "Ready" {
+			return true
+		}
+	}
+	return false
+}